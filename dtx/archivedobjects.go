@@ -0,0 +1,157 @@
+package dtx
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"howett.net/plist"
+)
+
+//cocoaEpoch is the reference date NSDate time intervals are relative to
+var cocoaEpoch = time.Date(2001, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+//archivedObject is the undecoded root object of an NSKeyedArchiver archive. The nskeyedarchiver
+//library only supports primitives, arrays and dictionaries, other classes like NSDate are read from here.
+type archivedObject struct {
+	className string
+	fields    map[string]interface{}
+	objects   []interface{}
+}
+
+func parseArchivedObject(archive []byte) (archivedObject, error) {
+	root, objects, err := parseArchiveRoot(archive)
+	if err != nil {
+		return archivedObject{}, err
+	}
+	fields, ok := root.(map[string]interface{})
+	if !ok {
+		return archivedObject{}, fmt.Errorf("Archived root object is a primitive: %v", root)
+	}
+	classRef, ok := fields["$class"].(plist.UID)
+	if !ok || int(classRef) >= len(objects) {
+		return archivedObject{}, fmt.Errorf("Archived root object has no class")
+	}
+	classInfo, ok := objects[classRef].(map[string]interface{})
+	if !ok {
+		return archivedObject{}, fmt.Errorf("Archived root object has an invalid class")
+	}
+	className, _ := classInfo["$classname"].(string)
+	return archivedObject{className: className, fields: fields, objects: objects}, nil
+}
+
+//parseArchiveRoot returns the undecoded root object of an archive together with the object table
+func parseArchiveRoot(archive []byte) (interface{}, []interface{}, error) {
+	var archiveData map[string]interface{}
+	_, err := plist.Unmarshal(archive, &archiveData)
+	if err != nil {
+		return nil, nil, err
+	}
+	objects, ok := archiveData["$objects"].([]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("Invalid NSKeyedArchiver archive, missing $objects")
+	}
+	top, ok := archiveData["$top"].(map[string]interface{})
+	if !ok {
+		return nil, nil, fmt.Errorf("Invalid NSKeyedArchiver archive, missing $top")
+	}
+	root, ok := top["root"].(plist.UID)
+	if !ok || int(root) >= len(objects) {
+		return nil, nil, fmt.Errorf("Invalid NSKeyedArchiver archive, bad root reference")
+	}
+	return objects[root], objects, nil
+}
+
+func (o archivedObject) expectClass(className string) error {
+	if o.className != className {
+		return fmt.Errorf("Expected archived %s but got %s", className, o.className)
+	}
+	return nil
+}
+
+func unarchiveDate(archive []byte) (time.Time, error) {
+	object, err := parseArchivedObject(archive)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := object.expectClass("NSDate"); err != nil {
+		return time.Time{}, err
+	}
+	seconds, ok := object.fields["NS.time"].(float64)
+	if !ok {
+		return time.Time{}, fmt.Errorf("Archived NSDate has no NS.time: %v", object.fields)
+	}
+	if math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return time.Time{}, fmt.Errorf("Archived NSDate has the invalid NS.time %v", seconds)
+	}
+	//a time.Duration only covers about 292 years, so dates like NSDate.distantFuture are built from seconds and nanoseconds
+	whole := math.Floor(seconds)
+	nanoseconds := int64(math.Round((seconds - whole) * float64(time.Second)))
+	return time.Unix(cocoaEpoch.Unix()+int64(whole), nanoseconds).UTC(), nil
+}
+
+//unarchiveUUID returns the canonical, upper case string form of an archived NSUUID like NSUUID.UUIDString does
+func unarchiveUUID(archive []byte) (string, error) {
+	object, err := parseArchivedObject(archive)
+	if err != nil {
+		return "", err
+	}
+	if err := object.expectClass("NSUUID"); err != nil {
+		return "", err
+	}
+	b, ok := object.fields["NS.uuidbytes"].([]byte)
+	if !ok || len(b) != 16 {
+		return "", fmt.Errorf("Archived NSUUID has no valid NS.uuidbytes: %v", object.fields)
+	}
+	return fmt.Sprintf("%X-%X-%X-%X-%X", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+//unarchiveData returns the bytes of an archived NSData. NSData is archived as a plain data object,
+//NSMutableData as an object with an NS.data field.
+func unarchiveData(archive []byte) ([]byte, error) {
+	if detectPayloadFormat(archive) != FormatKeyedArchive {
+		return nil, fmt.Errorf("Not an NSKeyedArchiver archive")
+	}
+	if objects, err := decodePayload(archive, DefaultMaxPayloadDepth); err == nil && len(objects) == 1 {
+		if data, ok := objects[0].([]byte); ok {
+			return data, nil
+		}
+		return nil, fmt.Errorf("Archived object is not NSData: %v", objects[0])
+	}
+	object, err := parseArchivedObject(archive)
+	if err != nil {
+		return nil, err
+	}
+	if object.className != "NSData" && object.className != "NSMutableData" {
+		return nil, fmt.Errorf("Expected archived NSData but got %s", object.className)
+	}
+	data, ok := object.fields["NS.data"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("Archived %s has no NS.data: %v", object.className, object.fields)
+	}
+	return data, nil
+}
+
+//unarchiveNumber decodes an archived NSNumber. NSKeyedArchiver stores numbers as plist primitives, the plist
+//type tells whether it was a bool, an integer or a floating point number. Negative integers are not supported
+//by the nskeyedarchiver library, which is why the root is read directly.
+func unarchiveNumber(archive []byte) (interface{}, error) {
+	root, _, err := parseArchiveRoot(archive)
+	if err != nil {
+		return nil, err
+	}
+	switch v := root.(type) {
+	case bool:
+		return v, nil
+	case uint64:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("Expected archived NSNumber but got %T", root)
+	}
+}
@@ -0,0 +1,105 @@
+package dtx
+
+import (
+	"fmt"
+	"sort"
+
+	"howett.net/plist"
+)
+
+//The nskeyedarchiver library can only unarchive, so this is a minimal NSKeyedArchiver for the types
+//the unarchiver produces: nil, primitives, []byte, []interface{} and map[string]interface{}.
+type keyedArchiver struct {
+	objects []interface{}
+	classes map[string]plist.UID
+}
+
+func archive(roots []interface{}) ([]byte, error) {
+	a := keyedArchiver{objects: []interface{}{"$null"}, classes: map[string]plist.UID{}}
+	top := map[string]interface{}{}
+	for i, root := range roots {
+		uid, err := a.add(root)
+		if err != nil {
+			return nil, err
+		}
+		if len(roots) == 1 {
+			top["root"] = uid
+			break
+		}
+		top[fmt.Sprintf("$%d", i)] = uid
+	}
+	return plist.Marshal(map[string]interface{}{
+		"$version":  100000,
+		"$archiver": "NSKeyedArchiver",
+		"$top":      top,
+		"$objects":  a.objects,
+	}, plist.BinaryFormat)
+}
+
+func (a *keyedArchiver) add(object interface{}) (plist.UID, error) {
+	switch v := object.(type) {
+	case nil:
+		return plist.UID(0), nil
+	case string, bool, []byte, float32, float64, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return a.append(v), nil
+	case []interface{}:
+		refs, err := a.addAll(v)
+		if err != nil {
+			return 0, err
+		}
+		uid := a.append(nil)
+		a.objects[uid] = map[string]interface{}{"NS.objects": refs, "$class": a.class("NSArray")}
+		return uid, nil
+	case map[string]interface{}:
+		//sorted keys keep the output deterministic
+		names := make([]string, 0, len(v))
+		for key := range v {
+			names = append(names, key)
+		}
+		sort.Strings(names)
+		keys := make([]interface{}, len(names))
+		values := make([]interface{}, len(names))
+		for i, key := range names {
+			keys[i] = key
+			values[i] = v[key]
+		}
+		keyRefs, err := a.addAll(keys)
+		if err != nil {
+			return 0, err
+		}
+		valueRefs, err := a.addAll(values)
+		if err != nil {
+			return 0, err
+		}
+		uid := a.append(nil)
+		a.objects[uid] = map[string]interface{}{"NS.keys": keyRefs, "NS.objects": valueRefs, "$class": a.class("NSDictionary")}
+		return uid, nil
+	}
+	return 0, fmt.Errorf("Cannot archive object of type %T: %v", object, object)
+}
+
+func (a *keyedArchiver) addAll(objects []interface{}) ([]plist.UID, error) {
+	refs := make([]plist.UID, len(objects))
+	for i, object := range objects {
+		uid, err := a.add(object)
+		if err != nil {
+			return nil, err
+		}
+		refs[i] = uid
+	}
+	return refs, nil
+}
+
+func (a *keyedArchiver) append(object interface{}) plist.UID {
+	a.objects = append(a.objects, object)
+	return plist.UID(len(a.objects) - 1)
+}
+
+func (a *keyedArchiver) class(className string) plist.UID {
+	if uid, ok := a.classes[className]; ok {
+		return uid
+	}
+	uid := a.append(map[string]interface{}{"$classname": className, "$classes": []interface{}{className, "NSObject"}})
+	a.classes[className] = uid
+	return uid
+}
@@ -0,0 +1,70 @@
+package dtx
+
+import "fmt"
+
+//BuildAck builds an ack without payload and auxiliary, the frame a peer answers a method invocation with
+//when it has nothing to return. Pass the identifier and conversation index of the message being acknowledged.
+func BuildAck(identifier, conversationIndex, channelCode int) DtxMessage {
+	return DtxMessage{
+		Fragments:         1,
+		Identifier:        identifier,
+		ConversationIndex: conversationIndex,
+		ChannelCode:       channelCode,
+		MessageLength:     16,
+		PayloadHeader:     DtxPayloadHeader{MessageType: Ack},
+	}
+}
+
+//NewKeepAlive builds the lightest message a device accepts on an open channel, an ack without payload
+//and auxiliary. The Identifier is left at 0 for the caller or a Conn to assign.
+func NewKeepAlive(channel int) DtxMessage {
+	return BuildAck(0, 0, channel)
+}
+
+//GenerateAckStream encodes count keep alive acks for channel with the identifiers 1 to count,
+//meant for stress testing decoders and device links.
+func GenerateAckStream(count int, channel int) [][]byte {
+	result := make([][]byte, count)
+	for i := range result {
+		msg := NewKeepAlive(channel)
+		msg.Identifier = i + 1
+		//Encode only fails for auxiliaries and payloads, an ack has neither
+		result[i], _ = Encode(msg)
+	}
+	return result
+}
+
+//BuildMethodInvocation builds a call of selector on channel. int32, int64 and DtxPrimitiveDictionary arguments
+//are stored as primitive auxiliary entries, nil as a null entry and all other arguments are archived.
+//Identifier and ConversationIndex are left at 0 for the caller or a Conn to assign.
+func BuildMethodInvocation(selector string, channel int, args []interface{}, expectsReply bool) (DtxMessage, error) {
+	aux := NewPrimitiveDictionary()
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case nil:
+			aux.AddNull()
+		case int32:
+			aux.AddInt32(v)
+		case int64:
+			aux.AddInt64(v)
+		case DtxPrimitiveDictionary:
+			aux.AddDictionary(v)
+		default:
+			if err := aux.AddObject(v); err != nil {
+				return DtxMessage{}, fmt.Errorf("Cannot archive argument %d of %s: %w", i, selector, err)
+			}
+		}
+	}
+	messageType := MethodinvocationWithoutExpectedReply
+	if expectsReply {
+		messageType = MethodInvocationWithExpectedReply
+	}
+	return DtxMessage{
+		Fragments:     1,
+		ChannelCode:   channel,
+		ExpectsReply:  expectsReply,
+		PayloadHeader: DtxPayloadHeader{MessageType: messageType},
+		Auxiliary:     aux,
+		Payload:       []interface{}{selector},
+	}, nil
+}
@@ -0,0 +1,95 @@
+package dtx_test
+
+import (
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewKeepAlive(t *testing.T) {
+	keepAlive := dtx.NewKeepAlive(3)
+	frame, err := dtx.Encode(keepAlive)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 48, len(frame))
+	msg, remainingBytes, err := dtx.Decode(frame)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, len(remainingBytes))
+		assert.Equal(t, 3, msg.ChannelCode)
+		assert.Equal(t, dtx.Ack, msg.PayloadHeader.MessageType)
+		assert.False(t, msg.HasPayload())
+		assert.False(t, msg.HasAuxiliary())
+		assert.Empty(t, dtx.Diff(keepAlive, msg))
+	}
+}
+
+func TestGenerateAckStream(t *testing.T) {
+	frames := dtx.GenerateAckStream(5, 2)
+	assert.Equal(t, 5, len(frames))
+	for i, frame := range frames {
+		msg, remainingBytes, err := dtx.Decode(frame)
+		if assert.NoError(t, err) {
+			assert.Equal(t, 0, len(remainingBytes))
+			assert.Equal(t, dtx.Ack, msg.PayloadHeader.MessageType)
+			assert.Equal(t, 2, msg.ChannelCode)
+			assert.Equal(t, i+1, msg.Identifier)
+		}
+	}
+	assert.Empty(t, dtx.GenerateAckStream(0, 2))
+}
+
+func TestBuildMethodInvocation(t *testing.T) {
+	identifier := "com.apple.instruments.server.services.deviceinfo"
+	msg, err := dtx.BuildMethodInvocation("_requestChannelWithCode:identifier:", 0, []interface{}{int32(4), identifier}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, dtx.MethodInvocationWithExpectedReply, msg.PayloadHeader.MessageType)
+	assert.Equal(t, 0, msg.Identifier)
+	frame, err := dtx.Encode(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	decoded, _, err := dtx.Decode(frame)
+	if assert.NoError(t, err) {
+		assert.Empty(t, dtx.Diff(msg, decoded))
+		assert.True(t, decoded.ExpectsReply)
+		call, ok := decoded.ParseKnownCall()
+		if assert.True(t, ok) {
+			assert.Equal(t, &dtx.RequestChannelCall{Code: 4, Identifier: identifier}, call.Arguments)
+		}
+	}
+
+	msg, err = dtx.BuildMethodInvocation("killPid:", 4, []interface{}{nil, int64(-1), map[string]interface{}{"pid": 42}}, false)
+	if assert.NoError(t, err) {
+		assert.Equal(t, dtx.MethodinvocationWithoutExpectedReply, msg.PayloadHeader.MessageType)
+		assert.False(t, msg.ExpectsReply)
+		assert.Equal(t, 4, msg.ChannelCode)
+		assert.Equal(t, []interface{}{nil, int64(-1), map[string]interface{}{"pid": uint64(42)}}, msg.Auxiliary.GetArguments())
+	}
+
+	_, err = dtx.BuildMethodInvocation("selector:", 1, []interface{}{struct{}{}}, false)
+	assert.Error(t, err)
+}
+
+func TestBuildAck(t *testing.T) {
+	ack := dtx.BuildAck(7, 1, 3)
+	assert.True(t, ack.IsAck())
+	frame, err := dtx.Encode(ack)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 48, len(frame))
+	msg, _, err := dtx.Decode(frame)
+	if assert.NoError(t, err) {
+		assert.True(t, msg.IsAck())
+		assert.Equal(t, 7, msg.Identifier)
+		assert.Equal(t, 1, msg.ConversationIndex)
+		assert.Equal(t, 3, msg.ChannelCode)
+		assert.False(t, msg.ExpectsReply)
+		assert.Empty(t, dtx.Diff(ack, msg))
+	}
+	assert.False(t, decodeFixture("fixtures/requestChannelWithCode").IsAck())
+}
@@ -0,0 +1,271 @@
+package dtx
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+//DecodeGzipCapture decodes a gzip compressed capture of frames that are each preceded by their length
+//as a big endian uint32, the format WriteLengthPrefixed produces.
+func DecodeGzipCapture(r io.Reader) ([]DtxMessage, error) {
+	reader, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("Capture is not a valid gzip stream: %w", err)
+	}
+	defer reader.Close()
+	var result []DtxMessage
+	for {
+		msg, err := DecodeLengthPrefixed(reader)
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, fmt.Errorf("Failed decoding frame %d of capture: %w", len(result), err)
+		}
+		result = append(result, msg)
+	}
+}
+
+//DecodeLengthPrefixed reads a big endian uint32 length from r and decodes the frame of that many bytes following it.
+//It returns io.EOF if r ends before the length and io.ErrUnexpectedEOF if it ends within the frame.
+func DecodeLengthPrefixed(r io.Reader) (DtxMessage, error) {
+	return DecodeLengthPrefixedOrder(r, binary.BigEndian)
+}
+
+//DecodeLengthPrefixedOrder works like DecodeLengthPrefixed for transports that write the length prefix in another
+//byte order, pass binary.LittleEndian for those framing frames with a little endian length.
+//The prefix has to cover the complete frame including its 32 byte header, a mismatch with MessageLength is an error.
+func DecodeLengthPrefixedOrder(r io.Reader, order binary.ByteOrder) (DtxMessage, error) {
+	frame, err := readLengthPrefixedFrame(r, order)
+	if err != nil {
+		return DtxMessage{}, err
+	}
+	msg, remainingBytes, err := Decode(frame)
+	if err != nil {
+		return DtxMessage{}, err
+	}
+	if len(remainingBytes) != 0 {
+		return DtxMessage{}, fmt.Errorf("Length prefix is %d bytes longer than the frame %s", len(remainingBytes), msg)
+	}
+	return msg, nil
+}
+
+//WriteLengthPrefixed encodes msgs and writes every frame preceded by its length as a big endian uint32.
+func WriteLengthPrefixed(w io.Writer, msgs []DtxMessage) error {
+	var buf []byte
+	for _, msg := range msgs {
+		var err error
+		buf, err = AppendEncode(append(buf[:0], 0, 0, 0, 0), msg)
+		if err != nil {
+			return err
+		}
+		binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+		if _, err := writeFull(w, buf); err != nil {
+			return fmt.Errorf("Failed writing frame %s: %w", msg, err)
+		}
+	}
+	return nil
+}
+
+//writeFull writes all of b, also to writers that report short writes without an error. It returns the number
+//of bytes written before an error occurred.
+func writeFull(w io.Writer, b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		n, err := w.Write(b[written:])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if n == 0 {
+			return written, io.ErrShortWrite
+		}
+	}
+	return written, nil
+}
+
+//FrameError is a frame of a capture that could not be decoded, Offset is where it starts in the capture.
+type FrameError struct {
+	Offset int
+	Err    error
+}
+
+func (e FrameError) Error() string {
+	return fmt.Sprintf("Failed decoding frame at offset %d: %v", e.Offset, e.Err)
+}
+
+func (e FrameError) Unwrap() error {
+	return e.Err
+}
+
+//CaptureErrors is returned by ReadCapture if frames of a capture were skipped.
+type CaptureErrors []FrameError
+
+func (e CaptureErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, frameError := range e {
+		messages[i] = frameError.Error()
+	}
+	return fmt.Sprintf("%d frames of capture could not be decoded: %s", len(e), strings.Join(messages, ", "))
+}
+
+//ReadCapture decodes a capture file holding concatenated frames, as WriteCapture writes them. A frame that cannot
+//be decoded is skipped up to the next magic, so the rest of a partially corrupt capture can still be inspected.
+//In that case all decoded messages are returned together with CaptureErrors telling the offset of every bad frame.
+//A frame whose payload alone cannot be decoded is not skipped, it is returned partially decoded, see PayloadError.
+func ReadCapture(r io.Reader) ([]DtxMessage, error) {
+	return ReadCaptureWithOptions(r, DecodeOptions{})
+}
+
+//ReadCaptureWithOptions works like ReadCapture but applies the given DecodeOptions to every frame. With
+//AllowLittleEndianMagic a bad frame is skipped up to the next magic in either byte order.
+func ReadCaptureWithOptions(r io.Reader, options DecodeOptions) ([]DtxMessage, error) {
+	capture, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var result []DtxMessage
+	var frameErrors CaptureErrors
+	offset := 0
+	//sequence counts every frame found in the capture, also the ones that could not be decoded
+	for sequence := 0; offset < len(capture); sequence++ {
+		msg, n, err := DecodeNWithOptions(capture[offset:], options)
+		if err != nil {
+			frameErrors = append(frameErrors, FrameError{Offset: offset, Err: err})
+		}
+		//n is only set for frames that could be cut out, at most their payload is broken
+		if n > 0 {
+			msg.Sequence = sequence
+			result = append(result, msg)
+			offset += n
+			continue
+		}
+		next := nextMagic(capture[offset+1:], options)
+		if next < 0 {
+			break
+		}
+		offset += 1 + next
+	}
+	if frameErrors != nil {
+		return result, frameErrors
+	}
+	return result, nil
+}
+
+//nextMagic returns the index of the first magic in b that options accept, or -1 if there is none
+func nextMagic(b []byte, options DecodeOptions) int {
+	var magic [4]byte
+	binary.BigEndian.PutUint32(magic[:], DtxMessageMagic)
+	next := bytes.Index(b, magic[:])
+	if options.AllowLittleEndianMagic {
+		binary.LittleEndian.PutUint32(magic[:], DtxMessageMagic)
+		if swapped := bytes.Index(b, magic[:]); swapped >= 0 && (next < 0 || swapped < next) {
+			next = swapped
+		}
+	}
+	return next
+}
+
+//WriteCapture writes msgs as concatenated frames, the format ReadCapture and DecodeAll read. Like with ReconstructStream,
+//decoded messages are written with the exact bytes they were decoded from, so a capture of a failing session
+//can be saved unchanged.
+func WriteCapture(w io.Writer, msgs []DtxMessage) error {
+	for i, msg := range msgs {
+		frame := msg.rawBytes
+		if frame == nil {
+			var err error
+			frame, err = Encode(msg)
+			if err != nil {
+				return fmt.Errorf("Failed encoding frame %d (%s): %w", i, msg, err)
+			}
+		}
+		if _, err := writeFull(w, frame); err != nil {
+			return fmt.Errorf("Failed writing frame %d (%s): %w", i, msg, err)
+		}
+	}
+	return nil
+}
+
+//maxBase64LineLength bounds the lines DecodeBase64Lines accepts, large enough for any frame seen so far
+const maxBase64LineLength = 64 * 1024 * 1024
+
+//DecodeBase64Lines decodes a text log holding one standard base64 encoded frame per line. Blank lines are skipped.
+func DecodeBase64Lines(r io.Reader) ([]DtxMessage, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxBase64LineLength)
+	var result []DtxMessage
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		frame := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
+		n, err := base64.StdEncoding.Decode(frame, text)
+		if err != nil {
+			return result, fmt.Errorf("Line %d is not valid base64: %w", line, err)
+		}
+		msg, remainingBytes, err := Decode(frame[:n])
+		if err != nil {
+			return result, fmt.Errorf("Failed decoding frame in line %d: %w", line, err)
+		}
+		if len(remainingBytes) != 0 {
+			return result, fmt.Errorf("Frame in line %d has %d trailing bytes", line, len(remainingBytes))
+		}
+		result = append(result, msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return result, fmt.Errorf("Failed reading line %d: %w", line+1, err)
+	}
+	return result, nil
+}
+
+//readLengthPrefixedFrame reads a uint32 length in the given byte order followed by that many bytes.
+//io.EOF is returned if r ends before the prefix, io.ErrUnexpectedEOF if it ends within a frame.
+func readLengthPrefixedFrame(r io.Reader, order binary.ByteOrder) ([]byte, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	length := order.Uint32(prefix[:])
+	if length < DtxHeaderLength {
+		return nil, fmt.Errorf("Length prefix %d is shorter than the %d byte header", length, DtxHeaderLength)
+	}
+	//check the prefix against the header before allocating, a wrong byte order makes for huge lengths
+	var header [32]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	msg, err := ParseHeaderArray(&header)
+	if err != nil {
+		return nil, err
+	}
+	frameLength := uint64(DtxHeaderLength)
+	if !msg.IsFirstFragment() {
+		frameLength += uint64(msg.MessageLength)
+	}
+	if frameLength != uint64(length) {
+		return nil, fmt.Errorf("Length prefix %d does not match the %d bytes of frame %s", length, frameLength, msg)
+	}
+	frame, err := readFrameBody(r, header[:], int(length), nil)
+	if err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+//unexpectedEOF turns io.EOF into io.ErrUnexpectedEOF for reads that started within a frame
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
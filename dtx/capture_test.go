@@ -0,0 +1,212 @@
+package dtx_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodeGzipCapture(t *testing.T) {
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	for _, name := range []string{"fixtures/notifyOfPublishedCapabilites", "fixtures/requestChannelWithCode"} {
+		dat, err := ioutil.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var prefix [4]byte
+		binary.BigEndian.PutUint32(prefix[:], uint32(len(dat)))
+		writer.Write(prefix[:])
+		writer.Write(dat)
+	}
+	writer.Close()
+
+	msgs, err := dtx.DecodeGzipCapture(bytes.NewReader(compressed.Bytes()))
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(msgs)) {
+		assert.Equal(t, decodeFixture("fixtures/notifyOfPublishedCapabilites").Payload, msgs[0].Payload)
+		assert.Equal(t, decodeFixture("fixtures/requestChannelWithCode").Payload, msgs[1].Payload)
+	}
+
+	_, err = dtx.DecodeGzipCapture(bytes.NewReader([]byte("not gzip at all")))
+	assert.Error(t, err)
+
+	corrupt := append([]byte{}, compressed.Bytes()...)
+	corrupt[len(corrupt)-5] ^= 0xff
+	_, err = dtx.DecodeGzipCapture(bytes.NewReader(corrupt))
+	assert.Error(t, err)
+}
+
+func TestDecodeBase64Lines(t *testing.T) {
+	var lines strings.Builder
+	names := []string{"fixtures/notifyOfPublishedCapabilites", "fixtures/requestChannelWithCode"}
+	for _, name := range names {
+		dat, err := ioutil.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		lines.WriteString(base64.StdEncoding.EncodeToString(dat))
+		lines.WriteString("\r\n\n")
+	}
+	msgs, err := dtx.DecodeBase64Lines(strings.NewReader(lines.String()))
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(msgs)) {
+		for i, name := range names {
+			expected := decodeFixture(name)
+			assert.Equal(t, expected.Identifier, msgs[i].Identifier)
+			assert.Equal(t, expected.Payload, msgs[i].Payload)
+		}
+	}
+
+	_, err = dtx.DecodeBase64Lines(strings.NewReader("\n!!not base64!!\n"))
+	assert.Error(t, err)
+}
+
+//trickleWriter accepts at most three bytes per Write, like a congested socket
+type trickleWriter struct {
+	bytes.Buffer
+}
+
+func (w *trickleWriter) Write(b []byte) (int, error) {
+	if len(b) > 3 {
+		b = b[:3]
+	}
+	return w.Buffer.Write(b)
+}
+
+func TestWriteLengthPrefixed(t *testing.T) {
+	msgs := []dtx.DtxMessage{
+		decodeFixture("fixtures/notifyOfPublishedCapabilites"),
+		dtx.NewKeepAlive(1),
+		decodeFixture("fixtures/requestChannelWithCode"),
+	}
+	var w trickleWriter
+	if !assert.NoError(t, dtx.WriteLengthPrefixed(&w, msgs)) {
+		return
+	}
+	first, err := dtx.Encode(msgs[0])
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint32(len(first)), binary.BigEndian.Uint32(w.Bytes()))
+	}
+
+	r := bytes.NewReader(w.Bytes())
+	for _, expected := range msgs {
+		msg, err := dtx.DecodeLengthPrefixed(r)
+		if assert.NoError(t, err) {
+			assert.Empty(t, dtx.Diff(expected, msg))
+		}
+	}
+	_, err = dtx.DecodeLengthPrefixed(r)
+	assert.Equal(t, io.EOF, err)
+
+	_, err = dtx.DecodeLengthPrefixed(bytes.NewReader(w.Bytes()[:20]))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+}
+
+func TestDecodeLengthPrefixedOrder(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	prefixed := func(order binary.ByteOrder, length int) []byte {
+		prefix := make([]byte, 4)
+		order.PutUint32(prefix, uint32(length))
+		return append(prefix, dat...)
+	}
+	stream := append(prefixed(binary.LittleEndian, len(dat)), prefixed(binary.LittleEndian, len(dat))...)
+	r := bytes.NewReader(stream)
+	for i := 0; i < 2; i++ {
+		msg, err := dtx.DecodeLengthPrefixedOrder(r, binary.LittleEndian)
+		if assert.NoError(t, err) {
+			assert.Equal(t, decodeFixture("fixtures/requestChannelWithCode").String(), msg.String())
+		}
+	}
+	_, err = dtx.DecodeLengthPrefixedOrder(r, binary.LittleEndian)
+	assert.Equal(t, io.EOF, err)
+
+	//the wrong byte order is caught before reading an absurdly long frame
+	_, err = dtx.DecodeLengthPrefixed(bytes.NewReader(prefixed(binary.LittleEndian, len(dat))))
+	assert.Error(t, err)
+	for _, length := range []int{len(dat) - 32, len(dat) - 1, len(dat) + 1, 8} {
+		_, err = dtx.DecodeLengthPrefixedOrder(bytes.NewReader(prefixed(binary.LittleEndian, length)), binary.LittleEndian)
+		assert.Error(t, err, "prefix %d", length)
+	}
+}
+
+func TestReadWriteCapture(t *testing.T) {
+	msgs := []dtx.DtxMessage{
+		decodeFixture("fixtures/notifyOfPublishedCapabilites"),
+		dtx.NewKeepAlive(1),
+		decodeFixture("fixtures/requestChannelWithCode"),
+	}
+	var w trickleWriter
+	if !assert.NoError(t, dtx.WriteCapture(&w, msgs)) {
+		return
+	}
+	capture := w.Bytes()
+	all, err := dtx.DecodeAll(capture)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(all))
+
+	read, err := dtx.ReadCapture(bytes.NewReader(capture))
+	if assert.NoError(t, err) && assert.Equal(t, 3, len(read)) {
+		for i := range msgs {
+			assert.True(t, msgs[i].Equal(read[i]), "frame %d", i)
+			assert.Equal(t, i, read[i].Sequence)
+		}
+	}
+
+	var rewritten bytes.Buffer
+	assert.NoError(t, dtx.WriteCapture(&rewritten, read))
+	assert.Equal(t, capture, rewritten.Bytes())
+
+	//garbage before the first frame and a broken magic in the second one
+	first, err := dtx.Encode(msgs[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+	corrupt := append([]byte{1, 2, 3}, capture...)
+	corrupt[3+len(first)] = 0
+	read, err = dtx.ReadCapture(bytes.NewReader(corrupt))
+	if assert.Equal(t, 2, len(read)) {
+		assert.True(t, msgs[0].Equal(read[0]))
+		assert.True(t, msgs[2].Equal(read[1]))
+		//the garbage and the broken frame count for the position in the capture
+		assert.Equal(t, 1, read[0].Sequence)
+		assert.Equal(t, 3, read[1].Sequence)
+	}
+	var frameErrors dtx.CaptureErrors
+	if assert.True(t, errors.As(err, &frameErrors), "%v", err) && assert.Equal(t, 2, len(frameErrors)) {
+		assert.Equal(t, 0, frameErrors[0].Offset)
+		assert.Equal(t, 3+len(first), frameErrors[1].Offset)
+		assert.True(t, errors.Is(frameErrors[1], dtx.ErrWrongMagic))
+	}
+	assert.Contains(t, err.Error(), "2 frames of capture could not be decoded")
+
+	//a frame whose payload cannot be unarchived is kept and the next frame is not searched for
+	broken := buildFrame(5, 1, nil, []byte("no archive"))
+	withBroken := append(append(append([]byte{}, first...), broken...), first...)
+	read, err = dtx.ReadCapture(bytes.NewReader(withBroken))
+	if assert.Equal(t, 3, len(read)) {
+		assert.Equal(t, 5, read[1].Identifier)
+		assert.True(t, msgs[0].Equal(read[2]))
+	}
+	frameErrors = nil
+	if assert.True(t, errors.As(err, &frameErrors), "%v", err) && assert.Equal(t, 1, len(frameErrors)) {
+		assert.Equal(t, len(first), frameErrors[0].Offset)
+		var payloadError *dtx.PayloadError
+		assert.True(t, errors.As(frameErrors[0], &payloadError))
+	}
+
+	read, err = dtx.ReadCapture(bytes.NewReader(nil))
+	assert.NoError(t, err)
+	assert.Empty(t, read)
+}
@@ -0,0 +1,92 @@
+package dtx
+
+import (
+	"errors"
+	"sync"
+)
+
+//ErrMuxClosed is returned by Push once the ChannelMux is closed
+var ErrMuxClosed = errors.New("ChannelMux is closed")
+
+//ChannelMux routes decoded messages onto one Go channel per DTX ChannelCode.
+//Messages for the same ChannelCode are delivered in the order they were pushed.
+//Every channel is buffered, once a buffer is full Push blocks until the consumer of
+//that channel catches up, which gives natural backpressure towards the reader.
+type ChannelMux struct {
+	mutex      sync.Mutex
+	bufferSize int
+	channels   map[int]chan DtxMessage
+	closed     bool
+	done       chan struct{}
+	//pushing counts the Pushes that may still send, Close waits for them before closing the channels
+	pushing sync.WaitGroup
+}
+
+//NewChannelMux creates a ChannelMux where every per channel buffer holds bufferSize messages.
+func NewChannelMux(bufferSize int) *ChannelMux {
+	return &ChannelMux{bufferSize: bufferSize, channels: map[int]chan DtxMessage{}, done: make(chan struct{})}
+}
+
+//Push delivers msg to the Go channel for msg.ChannelCode. It blocks if that channel's buffer is full.
+//ErrMuxClosed is returned if the ChannelMux is closed before or while Push waits, msg is not delivered then.
+func (m *ChannelMux) Push(msg DtxMessage) error {
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return ErrMuxClosed
+	}
+	c := m.channelLocked(msg.ChannelCode)
+	m.pushing.Add(1)
+	m.mutex.Unlock()
+	defer m.pushing.Done()
+	select {
+	case c <- msg:
+		return nil
+	case <-m.done:
+		return ErrMuxClosed
+	}
+}
+
+//Channel returns the receive only Go channel for the given ChannelCode, creating it if necessary.
+//After Close the returned channel is closed.
+func (m *ChannelMux) Channel(code int) <-chan DtxMessage {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.closed {
+		c := make(chan DtxMessage)
+		close(c)
+		return c
+	}
+	return m.channelLocked(code)
+}
+
+//Close closes all per channel Go channels after unblocking Pushes waiting for a full buffer.
+//Messages already buffered can still be received. Closing a closed ChannelMux does nothing.
+func (m *ChannelMux) Close() {
+	m.mutex.Lock()
+	if m.closed {
+		m.mutex.Unlock()
+		return
+	}
+	m.closed = true
+	close(m.done)
+	m.mutex.Unlock()
+	m.pushing.Wait()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for code, c := range m.channels {
+		close(c)
+		delete(m.channels, code)
+	}
+}
+
+//channelLocked returns the channel for code, creating it if necessary. The caller holds the mutex.
+func (m *ChannelMux) channelLocked(code int) chan DtxMessage {
+	c, ok := m.channels[code]
+	if !ok {
+		c = make(chan DtxMessage, m.bufferSize)
+		m.channels[code] = c
+	}
+	return c
+}
@@ -0,0 +1,51 @@
+package dtx_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelMuxKeepsOrderPerChannel(t *testing.T) {
+	mux := dtx.NewChannelMux(10)
+	for i := 0; i < 10; i++ {
+		assert.NoError(t, mux.Push(dtx.DtxMessage{Identifier: i, ChannelCode: i % 2}))
+	}
+	even := mux.Channel(0)
+	odd := mux.Channel(1)
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, 2*i, (<-even).Identifier)
+		assert.Equal(t, 2*i+1, (<-odd).Identifier)
+	}
+	mux.Close()
+	_, open := <-even
+	assert.False(t, open)
+}
+
+func TestChannelMuxCloseWhilePushBlocks(t *testing.T) {
+	mux := dtx.NewChannelMux(1)
+	channel := mux.Channel(0)
+	assert.NoError(t, mux.Push(dtx.DtxMessage{Identifier: 1}))
+	blocked := make(chan error)
+	go func() {
+		blocked <- mux.Push(dtx.DtxMessage{Identifier: 2})
+	}()
+	select {
+	case err := <-blocked:
+		t.Fatalf("Push into a full buffer returned %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mux.Close()
+	assert.Equal(t, dtx.ErrMuxClosed, <-blocked)
+	assert.Equal(t, dtx.ErrMuxClosed, mux.Push(dtx.DtxMessage{Identifier: 3}))
+	mux.Close()
+
+	assert.Equal(t, 1, (<-channel).Identifier)
+	_, open := <-channel
+	assert.False(t, open)
+	_, open = <-mux.Channel(0)
+	assert.False(t, open)
+}
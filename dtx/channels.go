@@ -0,0 +1,72 @@
+package dtx
+
+import (
+	"fmt"
+	"sync"
+)
+
+//ControlChannelCode is the code of the channel negotiated at handshake which carries meta-messages like
+//channel requests and capabilities. It is 0 for all devices seen so far, change it if yours differs.
+var ControlChannelCode = 0
+
+//IsControlChannel tells if the message is addressed to the control channel rather than to a service channel.
+func (d DtxMessage) IsControlChannel() bool {
+	return d.ChannelCode == ControlChannelCode
+}
+
+//ChannelRegistry maps channel codes to the names of the services they were requested for, for example
+//"com.apple.instruments.server.services.deviceinfo". The zero value is ready to use and it is safe for concurrent use.
+type ChannelRegistry struct {
+	mutex sync.RWMutex
+	names map[int]string
+}
+
+//ChannelNames is consulted by DtxMessage.String to show channel names next to the codes. It is nil by default,
+//set it to a registry that is filled during the handshake, for example with Observe.
+var ChannelNames *ChannelRegistry
+
+//Register stores the service name of a channel code, replacing an earlier name.
+func (r *ChannelRegistry) Register(code int, name string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.names == nil {
+		r.names = map[int]string{}
+	}
+	r.names[code] = name
+}
+
+//Name returns the service name of a channel. Replies from the device arrive on the negated code of a channel,
+//those are resolved to the name of the channel as well.
+func (r *ChannelRegistry) Name(code int) (string, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if name, ok := r.names[code]; ok {
+		return name, true
+	}
+	name, ok := r.names[-code]
+	return name, ok
+}
+
+//Observe registers the channel requested by a "_requestChannelWithCode:identifier:" message. It returns false
+//for all other messages, so every message of a session can be passed to it.
+func (r *ChannelRegistry) Observe(msg DtxMessage) bool {
+	call, ok := msg.ParseKnownCall()
+	if !ok {
+		return false
+	}
+	request, ok := call.Arguments.(*RequestChannelCall)
+	if !ok {
+		return false
+	}
+	r.Register(request.Code, request.Identifier)
+	return true
+}
+
+func channelString(code int) string {
+	if ChannelNames != nil {
+		if name, ok := ChannelNames.Name(code); ok {
+			return fmt.Sprintf("c%d(%s)", code, name)
+		}
+	}
+	return fmt.Sprintf("c%d", code)
+}
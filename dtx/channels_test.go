@@ -0,0 +1,44 @@
+package dtx_test
+
+import (
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsControlChannel(t *testing.T) {
+	control := decodeFixture("fixtures/requestChannelWithCode")
+	service := dtx.NewKeepAlive(1)
+	assert.True(t, control.IsControlChannel())
+	assert.False(t, service.IsControlChannel())
+
+	defer func(code int) { dtx.ControlChannelCode = code }(dtx.ControlChannelCode)
+	dtx.ControlChannelCode = 1
+	assert.False(t, control.IsControlChannel())
+	assert.True(t, service.IsControlChannel())
+}
+
+func TestChannelRegistry(t *testing.T) {
+	var registry dtx.ChannelRegistry
+	_, ok := registry.Name(1)
+	assert.False(t, ok)
+
+	assert.True(t, registry.Observe(decodeFixture("fixtures/requestChannelWithCode")))
+	assert.False(t, registry.Observe(decodeFixture("fixtures/notifyOfPublishedCapabilites")))
+	name, ok := registry.Name(1)
+	assert.True(t, ok)
+	assert.Equal(t, "dtxproxy:XCTestManager_IDEInterface:XCTestManager_DaemonConnectionInterface", name)
+	name, ok = registry.Name(-1)
+	assert.True(t, ok)
+	assert.Equal(t, "dtxproxy:XCTestManager_IDEInterface:XCTestManager_DaemonConnectionInterface", name)
+
+	registry.Register(2, "com.apple.instruments.server.services.deviceinfo")
+	msg := dtx.NewKeepAlive(2)
+	assert.Contains(t, msg.String(), " c2 ")
+
+	defer func(names *dtx.ChannelRegistry) { dtx.ChannelNames = names }(dtx.ChannelNames)
+	dtx.ChannelNames = &registry
+	assert.Contains(t, msg.String(), " c2(com.apple.instruments.server.services.deviceinfo) ")
+	assert.Contains(t, dtx.NewKeepAlive(3).String(), " c3 ")
+}
@@ -0,0 +1,73 @@
+package dtx
+
+import "container/list"
+
+//Clone returns a deep copy of the message that does not share any memory with d. After Decode the raw and fragment
+//bytes and the binary auxiliary entries alias the decoded buffer, after DecodeInto the auxiliary slices are reused
+//as well. Clone a message before queueing it if that buffer or message is reused.
+func (d DtxMessage) Clone() DtxMessage {
+	result := d
+	result.rawBytes = cloneBytes(d.rawBytes)
+	result.fragmentBytes = cloneBytes(d.fragmentBytes)
+	result.rawAuxiliary = cloneBytes(d.rawAuxiliary)
+	result.Auxiliary = d.Auxiliary.clone()
+	if d.Payload != nil {
+		result.Payload = cloneValue(d.Payload).([]interface{})
+	}
+	return result
+}
+
+func (d DtxPrimitiveDictionary) clone() DtxPrimitiveDictionary {
+	if d.keyValuePairs == nil {
+		return DtxPrimitiveDictionary{}
+	}
+	result := DtxPrimitiveDictionary{keyValuePairs: list.New()}
+	for e := d.keyValuePairs.Front(); e != nil; e = e.Next() {
+		pair := e.Value.(DtxPrimitiveKeyValuePair)
+		pair.key = cloneEntry(pair.key)
+		pair.value = cloneEntry(pair.value)
+		result.keyValuePairs.PushBack(pair)
+		result.valueTypes = append(result.valueTypes, pair.valueType)
+		result.values = append(result.values, pair.value)
+	}
+	return result
+}
+
+func cloneEntry(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return cloneBytes(v)
+	case DtxPrimitiveDictionary:
+		return v.clone()
+	default:
+		return value
+	}
+}
+
+func cloneValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, entry := range v {
+			result[key] = cloneValue(entry)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, entry := range v {
+			result[i] = cloneValue(entry)
+		}
+		return result
+	case []byte:
+		return cloneBytes(v)
+	default:
+		return value
+	}
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,47 @@
+package dtx_test
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClone(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	buffer := append([]byte{}, dat...)
+	msg, _, err := dtx.Decode(buffer)
+	if err != nil {
+		log.Fatal(err)
+	}
+	clone := msg.Clone()
+	for i := range buffer {
+		buffer[i] = 0xff
+	}
+	expected, _, _ := dtx.Decode(dat)
+	assert.Equal(t, dat, clone.RawBytes())
+	assert.Equal(t, expected.Auxiliary.GetArguments(), clone.Auxiliary.GetArguments())
+	assert.Equal(t, expected.Payload, clone.Payload)
+	assert.True(t, expected.Equal(clone), "%v", dtx.Diff(expected, clone))
+
+	var reused dtx.DtxMessage
+	_, err = dtx.DecodeInto(dat, &reused)
+	assert.NoError(t, err)
+	clone = reused.Clone()
+	other, err := ioutil.ReadFile("fixtures/notifyOfPublishedCapabilites")
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = dtx.DecodeInto(other, &reused)
+	assert.NoError(t, err)
+	reused.Auxiliary.AddInt32(5)
+	assert.Equal(t, expected.Auxiliary.GetArguments(), clone.Auxiliary.GetArguments())
+
+	assert.Nil(t, dtx.DtxMessage{}.Clone().Payload)
+}
@@ -0,0 +1,80 @@
+package dtx
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+//PayloadFlagCompressionMask selects the bits of DtxPayloadHeader.Flags that are assumed to tell how the payload is
+//compressed, zero means it is not compressed. The position is a guess, none of the fixtures is compressed, so the
+//bits are only interpreted with DecodeOptions.DecompressPayload.
+const PayloadFlagCompressionMask = 0xF0000
+
+//PayloadCompressionDeflate is the only compression known so far. The payload starts with the uncompressed length
+//as a little endian uint32 followed by a raw DEFLATE stream, which is what COMPRESSION_ZLIB of Apple's libcompression produces.
+const PayloadCompressionDeflate = 0x10000
+
+//MaxDecompressedPayloadSize is the largest uncompressed length a compressed payload may declare
+const MaxDecompressedPayloadSize = 64 << 20
+
+//ErrUnsupportedCompression is returned when a payload is compressed with an algorithm this package cannot decompress
+var ErrUnsupportedCompression = errors.New("Unsupported payload compression")
+
+//Compression returns the compression bits of the flags, zero for uncompressed payloads
+func (p DtxPayloadHeader) Compression() int {
+	return p.Flags & PayloadFlagCompressionMask
+}
+
+//WasCompressed tells if the payload of the message was decompressed, which only happens for messages decoded with
+//DecodeOptions.DecompressPayload. Payload then holds the decompressed objects, PayloadBytes returns the compressed bytes.
+func (d DtxMessage) WasCompressed() bool {
+	return d.decompressPayload && d.PayloadHeader.Compression() != 0
+}
+
+//uncompressedPayload returns the payload bytes ready for unarchiving, decompressing them if necessary
+func (d DtxMessage) uncompressedPayload() ([]byte, error) {
+	payload := d.payloadBytes()
+	if !d.decompressPayload {
+		return payload, nil
+	}
+	switch compression := d.PayloadHeader.Compression(); compression {
+	case 0:
+		return payload, nil
+	case PayloadCompressionDeflate:
+		return inflatePayload(payload)
+	default:
+		return nil, fmt.Errorf("%w: flag bits 0x%x of payload header flags 0x%x", ErrUnsupportedCompression, compression, d.PayloadHeader.Flags)
+	}
+}
+
+func inflatePayload(payload []byte) ([]byte, error) {
+	if len(payload) < 4 {
+		return nil, fmt.Errorf("Compressed payload of %d bytes is missing the uncompressed length", len(payload))
+	}
+	length := binary.LittleEndian.Uint32(payload)
+	if length > MaxDecompressedPayloadSize {
+		return nil, fmt.Errorf("Compressed payload declares %d uncompressed bytes, at most %d are supported", length, MaxDecompressedPayloadSize)
+	}
+	//one byte more than declared is read to detect streams that inflate beyond the declared length
+	reader := io.LimitReader(flate.NewReader(bytes.NewReader(payload[4:])), int64(length)+1)
+	result, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("Failed decompressing payload: %w", err)
+	}
+	if uint32(len(result)) != length {
+		return nil, fmt.Errorf("Decompressed payload has %s bytes, expected %d", decompressedLength(len(result), length), length)
+	}
+	return result, nil
+}
+
+func decompressedLength(n int, declared uint32) string {
+	if n > int(declared) {
+		return fmt.Sprintf("more than %d", declared)
+	}
+	return fmt.Sprint(n)
+}
@@ -0,0 +1,128 @@
+package dtx_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//compressFrame rebuilds a decoded frame with its payload compressed the way PayloadCompressionDeflate describes.
+//No capture of a compressed frame from a device is available, so the tests only show that decoding agrees with
+//the guessed flag and format. Add such a capture to fixtures and decode it here once one turns up.
+func compressFrame(frame []byte) []byte {
+	msg, _, err := dtx.Decode(frame)
+	if err != nil {
+		log.Fatal(err)
+	}
+	payload := msg.PayloadBytes()
+	var compressed bytes.Buffer
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(payload)))
+	compressed.Write(length[:])
+	w, _ := flate.NewWriter(&compressed, flate.BestCompression)
+	w.Write(payload)
+	w.Close()
+	result := buildFrame(msg.Identifier, msg.ChannelCode, frame[64:48+msg.PayloadHeader.AuxiliaryLength], compressed.Bytes())
+	binary.LittleEndian.PutUint32(result[44:], dtx.PayloadCompressionDeflate)
+	return result
+}
+
+func TestCompressedPayload(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	expected, _, err := dtx.Decode(dat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	assert.False(t, expected.WasCompressed())
+	options := dtx.DecodeOptions{DecompressPayload: true}
+
+	frame := compressFrame(dat)
+	msg, _, err := dtx.DecodeWithOptions(frame, options)
+	if assert.NoError(t, err) {
+		assert.True(t, msg.WasCompressed())
+		assert.Equal(t, expected.Payload, msg.Payload)
+		assert.Equal(t, expected.Auxiliary.GetArguments(), msg.Auxiliary.GetArguments())
+		assert.Equal(t, dtx.FormatKeyedArchive, msg.PayloadFormat())
+
+		encoded, err := dtx.Encode(msg)
+		assert.NoError(t, err)
+		reencoded, _, err := dtx.Decode(encoded)
+		if assert.NoError(t, err) {
+			assert.False(t, reencoded.WasCompressed())
+			assert.Equal(t, expected.Payload, reencoded.Payload)
+		}
+	}
+
+	options.LazyPayload = true
+	lazy, _, err := dtx.DecodeWithOptions(frame, options)
+	if assert.NoError(t, err) {
+		payload, err := lazy.DecodePayload()
+		assert.NoError(t, err)
+		assert.Equal(t, expected.Payload, payload)
+	}
+	options.LazyPayload = false
+
+	binary.LittleEndian.PutUint32(frame[44:], 0x30000)
+	_, _, err = dtx.DecodeWithOptions(frame, options)
+	assert.True(t, errors.Is(err, dtx.ErrUnsupportedCompression))
+	assert.Contains(t, err.Error(), "0x30000")
+}
+
+func TestCompressionFlagsIgnoredByDefault(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	flagged := append([]byte{}, dat...)
+	binary.LittleEndian.PutUint32(flagged[44:], 0x30000)
+	msg, _, err := dtx.Decode(flagged)
+	if assert.NoError(t, err) {
+		assert.False(t, msg.WasCompressed())
+		assert.Equal(t, "_requestChannelWithCode:identifier:", msg.Payload[0])
+		encoded, err := dtx.Encode(msg)
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(0x30000), binary.LittleEndian.Uint32(encoded[44:]))
+	}
+}
+
+func TestCompressedPayloadLength(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	options := dtx.DecodeOptions{DecompressPayload: true}
+	frame := compressFrame(dat)
+	payloadOffset := 48 + int(binary.LittleEndian.Uint32(frame[36:]))
+	declared := binary.LittleEndian.Uint32(frame[payloadOffset:])
+
+	for _, length := range []uint32{declared - 1, declared + 1, dtx.MaxDecompressedPayloadSize + 1} {
+		binary.LittleEndian.PutUint32(frame[payloadOffset:], length)
+		_, _, err = dtx.DecodeWithOptions(frame, options)
+		var payloadError *dtx.PayloadError
+		assert.True(t, errors.As(err, &payloadError), "%d: %v", length, err)
+	}
+
+	//a small frame must not inflate beyond the length it declares
+	var bomb bytes.Buffer
+	bomb.Write([]byte{0x10, 0, 0, 0})
+	w, _ := flate.NewWriter(&bomb, flate.BestCompression)
+	w.Write(make([]byte, 8<<20))
+	w.Close()
+	frame = buildFrame(1, 1, nil, bomb.Bytes())
+	binary.LittleEndian.PutUint32(frame[44:], dtx.PayloadCompressionDeflate)
+	_, _, err = dtx.DecodeWithOptions(frame, options)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "more than 16")
+	}
+}
@@ -0,0 +1,38 @@
+package dtx
+
+import "sync"
+
+//Conn sends and receives DtxMessages over a Transport and hands out message identifiers.
+type Conn struct {
+	transport  Transport
+	decoder    *Decoder
+	mutex      sync.Mutex
+	identifier int
+}
+
+//NewConn creates a Conn on top of t.
+func NewConn(t Transport) *Conn {
+	return &Conn{transport: t, decoder: DecoderFromTransport(t)}
+}
+
+//Send encodes msg and writes it as one frame.
+func (c *Conn) Send(msg DtxMessage) error {
+	frame, err := Encode(msg)
+	if err != nil {
+		return err
+	}
+	return c.transport.WriteFrame(frame)
+}
+
+//Receive reads the next message.
+func (c *Conn) Receive() (DtxMessage, error) {
+	return c.decoder.Decode()
+}
+
+//NextIdentifier returns a new, unused message identifier. Identifiers start at 1.
+func (c *Conn) NextIdentifier() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.identifier++
+	return c.identifier
+}
@@ -1,12 +1,13 @@
 package dtx
 
 import (
-	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
-
-	"github.com/danielpaulus/nskeyedarchiver"
+	"hash/crc32"
+	"io"
+	"sync"
 )
 
 type DtxMessage struct {
@@ -21,8 +22,11 @@ type DtxMessage struct {
 	Payload           []interface{}
 	AuxiliaryHeader   AuxiliaryHeader
 	Auxiliary         DtxPrimitiveDictionary
+	Sequence          int //position of the frame in the decoded stream counting from 0 and including frames that failed to decode, set by DecodeAll, ReadCapture and Decoder
 	rawBytes          []byte
 	fragmentBytes     []byte
+	rawAuxiliary      []byte
+	decompressPayload bool //set by DecodeOptions.DecompressPayload
 }
 
 //16 Bytes
@@ -33,9 +37,27 @@ type DtxPayloadHeader struct {
 	Flags              int
 }
 
+//Bits of DtxPayloadHeader.Flags. The values are guesses: none of the captured frames in the fixtures sets
+//any flag, so they stay unexported until a capture confirms them.
+const (
+	payloadFlagExpectsReply = 0x1000
+	payloadFlagIsReply      = 0x2000
+)
+
+//ExpectsReply tells if the payload header flags have the tentative expects reply bit set. None of the captured
+//frames sets it, the routing header's ExpectsReply is authoritative for those.
+func (p DtxPayloadHeader) ExpectsReply() bool {
+	return p.Flags&payloadFlagExpectsReply != 0
+}
+
+//IsReply tells if the payload header flags have the tentative is reply bit set.
+func (p DtxPayloadHeader) IsReply() bool {
+	return p.Flags&payloadFlagIsReply != 0
+}
+
 //This header can actually be completely ignored. We do not need to care about the buffer size
 //And we already know the AuxiliarySize. The other two ints seem to be always 0 anyway. Could
-//also be that Buffer and Aux Size are Uint64
+//also be that Buffer and Aux Size are Uint64, AuxiliaryLayout tells which reading fits a message.
 type AuxiliaryHeader struct {
 	BufferSize    uint32
 	Unknown       uint32
@@ -47,22 +69,65 @@ func (a AuxiliaryHeader) String() string {
 	return fmt.Sprintf("BufSiz:%d Unknown:%d AuxSiz:%d Unknown2:%d", a.BufferSize, a.Unknown, a.AuxiliarySize, a.Unknown2)
 }
 
+//AuxiliaryLayout tells which reading of the AuxiliaryHeader fits the AuxiliaryLength of a message: four uint32 fields
+//or a uint64 BufferSize followed by a uint64 AuxiliarySize.
+type AuxiliaryLayout int
+
+const (
+	//AuxiliaryLayoutEither means the unknown fields are 0, so both readings give the right AuxiliarySize.
+	//All captured frames so far look like this.
+	AuxiliaryLayoutEither AuxiliaryLayout = iota
+	//AuxiliaryLayoutUint32 means only the uint32 AuxiliarySize fits, the Unknown2 field is set.
+	AuxiliaryLayoutUint32
+	//AuxiliaryLayoutMismatch means AuxiliarySize does not fit AuxiliaryLength with either reading.
+	AuxiliaryLayoutMismatch
+)
+
+func (l AuxiliaryLayout) String() string {
+	switch l {
+	case AuxiliaryLayoutEither:
+		return "either"
+	case AuxiliaryLayoutUint32:
+		return "uint32"
+	default:
+		return "mismatch"
+	}
+}
+
+//AuxiliaryLayout cross checks AuxiliaryHeader.AuxiliarySize against PayloadHeader.AuxiliaryLength, which includes
+//the 16 byte header, with both possible layouts of the header. Messages without auxiliary report AuxiliaryLayoutEither.
+func (d DtxMessage) AuxiliaryLayout() AuxiliaryLayout {
+	if !d.HasAuxiliary() {
+		return AuxiliaryLayoutEither
+	}
+	expected := uint64(d.PayloadHeader.AuxiliaryLength - 16)
+	size64 := uint64(d.AuxiliaryHeader.Unknown2)<<32 | uint64(d.AuxiliaryHeader.AuxiliarySize)
+	switch {
+	case size64 == expected:
+		return AuxiliaryLayoutEither
+	case uint64(d.AuxiliaryHeader.AuxiliarySize) == expected:
+		return AuxiliaryLayoutUint32
+	default:
+		return AuxiliaryLayoutMismatch
+	}
+}
+
 func (d DtxMessage) String() string {
 	var e = ""
 	if d.ExpectsReply {
 		e = "e"
 	}
 	msgtype := fmt.Sprintf("Unknown:%d", d.PayloadHeader.MessageType)
-	if knowntype, ok := messageTypeLookup[d.PayloadHeader.MessageType]; ok {
+	if knowntype, ok := MessageTypeName(d.PayloadHeader.MessageType); ok {
 		msgtype = knowntype
 	}
 
-	return fmt.Sprintf("i%d.%d%s c%d t:%s mlen:%d aux_len%d paylen%d", d.Identifier, d.ConversationIndex, e, d.ChannelCode, msgtype,
+	return fmt.Sprintf("i%d.%d%s %s t:%s mlen:%d aux_len%d paylen%d", d.Identifier, d.ConversationIndex, e, channelString(d.ChannelCode), msgtype,
 		d.MessageLength, d.PayloadHeader.AuxiliaryLength, d.PayloadLength())
 }
 
 func (d DtxMessage) StringDebug() string {
-	if Ack == d.PayloadHeader.MessageType {
+	if d.IsAck() {
 		return d.String()
 	}
 	payload := "none"
@@ -75,16 +140,38 @@ func (d DtxMessage) StringDebug() string {
 	}
 	return fmt.Sprintf("no aux,payload: %s \nrawbytes:%x", payload, d.rawBytes)
 }
-func (d DtxMessage) parsePayloadBytes(messageBytes []byte) ([]interface{}, error) {
-	offset := 0
-	if d.HasAuxiliary() && d.HasPayload() {
-		offset = 48 + d.PayloadHeader.AuxiliaryLength
-	}
-	if !d.HasAuxiliary() && d.HasPayload() {
-		offset = 48
+
+//RawBytes returns a copy of the frame bytes the message was decoded from, including the header, for forwarding
+//a message verbatim. It returns nil for messages that were built instead of decoded.
+func (d DtxMessage) RawBytes() []byte {
+	return cloneBytes(d.rawBytes)
+}
+
+//FragmentBytes returns a copy of the message bytes a fragment carries after its header. It returns nil for
+//messages that are not fragmented and for first fragments, which only consist of a header.
+func (d DtxMessage) FragmentBytes() []byte {
+	return cloneBytes(d.fragmentBytes)
+}
+
+func (d DtxMessage) parsePayloadBytes(codec PayloadCodec) ([]interface{}, error) {
+	payload, err := d.uncompressedPayload()
+	if err != nil {
+		return nil, err
 	}
+	return codec.Unarchive(payload)
+}
 
-	return nskeyedarchiver.Unarchive(messageBytes[offset:])
+//AuxiliaryCount returns the number of auxiliary arguments by walking the raw auxiliary bytes
+//without decoding the individual values.
+func (d DtxMessage) AuxiliaryCount() (int, error) {
+	if !d.HasAuxiliary() {
+		return 0, nil
+	}
+	end := 48 + d.PayloadHeader.AuxiliaryLength
+	if end > len(d.rawBytes) || end < 64 {
+		return 0, fmt.Errorf("AuxiliaryLength %d does not fit the message of %d bytes", d.PayloadHeader.AuxiliaryLength, len(d.rawBytes))
+	}
+	return countAuxiliaryEntries(d.rawBytes[64:end])
 }
 
 func (d DtxMessage) PayloadLength() int {
@@ -111,19 +198,80 @@ var messageTypeLookup = map[int]string{
 	Ack:                                  `Ack`,
 }
 
+//messageTypeMutex guards messageTypeLookup, types may be registered while messages are printed
+var messageTypeMutex sync.RWMutex
+
+//MessageTypeName returns the name of a message type as String prints it, ok is false for unknown types.
+func MessageTypeName(t int) (string, bool) {
+	messageTypeMutex.RLock()
+	defer messageTypeMutex.RUnlock()
+	name, ok := messageTypeLookup[t]
+	return name, ok
+}
+
+//MessageTypeByName returns the message type registered under name. If several types share the name,
+//the lowest one is returned.
+func MessageTypeByName(name string) (int, bool) {
+	messageTypeMutex.RLock()
+	defer messageTypeMutex.RUnlock()
+	result, found := 0, false
+	for t, typeName := range messageTypeLookup {
+		if typeName == name && (!found || t < result) {
+			result, found = t, true
+		}
+	}
+	return result, found
+}
+
+//RegisterMessageType names a message type, for example one that was reverse engineered from a capture.
+//Registering a known type again replaces its name.
+func RegisterMessageType(t int, name string) {
+	messageTypeMutex.Lock()
+	defer messageTypeMutex.Unlock()
+	messageTypeLookup[t] = name
+}
+
 const (
 	DtxMessageMagic uint32 = 0x795B3D1F
 	DtxHeaderLength uint32 = 32
 	DtxReservedBits uint32 = 0x0
 )
 
+//IsAck tells if the message is an ack, the message type peers use to acknowledge a method invocation.
+//Acks answering a request are replies as well, see IsReply. Fragments are never acks: only the first fragment has a
+//payload header, so the MessageType of the others is 0 like that of an ack.
+func (d DtxMessage) IsAck() bool {
+	return !d.IsFragment() && d.PayloadHeader.MessageType == Ack
+}
+
+//IsMethodInvocation tells if the message starts a conversation by calling a method: ConversationIndex is 0 and
+//MessageType is MethodInvocationWithExpectedReply or MethodinvocationWithoutExpectedReply.
+func (d DtxMessage) IsMethodInvocation() bool {
+	messageType := d.PayloadHeader.MessageType
+	return d.ConversationIndex == 0 && (messageType == MethodInvocationWithExpectedReply || messageType == MethodinvocationWithoutExpectedReply)
+}
+
+//IsRequest tells if the message is a method invocation the peer has to answer: IsMethodInvocation holds and the
+//routing header has ExpectsReply set. The payload header flags are not used, captured frames do not set them.
+func (d DtxMessage) IsRequest() bool {
+	return d.IsMethodInvocation() && d.ExpectsReply
+}
+
+//IsReply tells if the message answers an earlier one: ConversationIndex is greater than 0. The reply carries the
+//Identifier of the request, whatever its MessageType is, acks and return values alike.
+func (d DtxMessage) IsReply() bool {
+	return d.ConversationIndex > 0
+}
+
 //This message is only 32 bytes long
 func (d DtxMessage) IsFirstFragment() bool {
 	return d.Fragments > 1 && d.FragmentIndex == 0
 }
 
+//IsLastFragment tells if this is the final fragment of a message. The fields are compared as ints, so inconsistent
+//headers that Decode rejects cannot make it true by wrapping around.
 func (d DtxMessage) IsLastFragment() bool {
-	return d.Fragments-d.FragmentIndex == 1
+	return int(d.FragmentIndex)+1 == int(d.Fragments)
 }
 
 func (d DtxMessage) IsFragment() bool {
@@ -131,76 +279,496 @@ func (d DtxMessage) IsFragment() bool {
 }
 
 //Indicates whether the message you call this on, is the first part of a fragmented message, and if otherMessage is a subsequent fragment
+//It panics if the message is not a first fragment.
+//
+//Deprecated: use IsFirstFragmentFor, which returns an error instead of panicking.
 func (d DtxMessage) MessageIsFirstFragmentFor(otherMessage DtxMessage) bool {
-	if !d.IsFirstFragment() {
+	isFirst, err := d.IsFirstFragmentFor(otherMessage)
+	if err != nil {
 		panic("Illegal state")
 	}
-	return d.Identifier == otherMessage.Identifier && d.Fragments == otherMessage.Fragments && otherMessage.FragmentIndex > 0
+	return isFirst
+}
+
+//IsFirstFragmentFor indicates whether the message you call this on is the first part of a fragmented message,
+//and if otherMessage is a subsequent fragment. It returns an error if the message is not a first fragment.
+func (d DtxMessage) IsFirstFragmentFor(otherMessage DtxMessage) (bool, error) {
+	if !d.IsFirstFragment() {
+		return false, fmt.Errorf("Message %s is not the first fragment of a fragmented message", d)
+	}
+	return d.Identifier == otherMessage.Identifier && d.Fragments == otherMessage.Fragments && otherMessage.FragmentIndex > 0, nil
+}
+
+//ParseHeaderArray parses the 32 byte routing header from a fixed size array without allocating.
+//It only populates the header fields, the payload header and auxiliary are left empty.
+func ParseHeaderArray(b *[32]byte) (DtxMessage, error) {
+	return parseHeaderArray(b, DecodeOptions{})
+}
+
+//parseHeaderArray is ParseHeaderArray honoring AllowLittleEndianMagic of options
+func parseHeaderArray(b *[32]byte, options DecodeOptions) (DtxMessage, error) {
+	//only the decoded values are formatted, passing slices of b would make the array escape to the heap
+	if !options.hasValidMagic(b[0:4]) {
+		return DtxMessage{}, decodeError(StageMagic, 0, fmt.Errorf("%w: %08x", ErrWrongMagic, binary.BigEndian.Uint32(b[0:4])))
+	}
+	if headerLength := binary.LittleEndian.Uint32(b[4:8]); headerLength != DtxHeaderLength {
+		return DtxMessage{}, decodeError(StageHeader, 4, fmt.Errorf("%w: %08x", ErrBadHeaderLength, headerLength))
+	}
+	result := DtxMessage{}
+	result.FragmentIndex = binary.LittleEndian.Uint16(b[8:10])
+	result.Fragments = binary.LittleEndian.Uint16(b[10:12])
+	result.MessageLength = int(binary.LittleEndian.Uint32(b[12:16]))
+	result.Identifier = int(binary.LittleEndian.Uint32(b[16:20]))
+	result.ConversationIndex = int(int32(binary.LittleEndian.Uint32(b[20:24])))
+	//reply channels are negative
+	result.ChannelCode = int(int32(binary.LittleEndian.Uint32(b[24:28])))
+	result.ExpectsReply = binary.LittleEndian.Uint32(b[28:32]) == uint32(1)
+	if err := checkFragmentHeader(result); err != nil {
+		return DtxMessage{}, decodeError(StageHeader, 8, err)
+	}
+	return result, nil
+}
+
+//checkFragmentHeader makes sure FragmentIndex is smaller than Fragments. Frames with Fragments 0 are accepted
+//as unfragmented messages as long as their FragmentIndex is 0.
+func checkFragmentHeader(msg DtxMessage) error {
+	fragments := msg.Fragments
+	if fragments == 0 {
+		fragments = 1
+	}
+	if msg.FragmentIndex >= fragments {
+		return fmt.Errorf("%w: FragmentIndex %d of %d fragments", ErrInvalidFragmentIndex, msg.FragmentIndex, msg.Fragments)
+	}
+	return nil
+}
+
+//DecodeOptions enables workarounds for peers that do not produce perfectly standard DTX frames.
+//The zero value decodes standard frames only.
+type DecodeOptions struct {
+	//AllowLittleEndianMagic accepts frames whose magic was written byte swapped
+	AllowLittleEndianMagic bool
+	//TrailingCRC expects a little endian CRC32 (IEEE) of the frame bytes after every frame, it is verified and stripped
+	TrailingCRC bool
+	//MessageLengthIncludesHeader is needed for devices that count the 32 byte header in MessageLength
+	MessageLengthIncludesHeader bool
+	//MaxPayloadDepth limits how deep arrays and dictionaries in the payload may nest, 0 means DefaultMaxPayloadDepth.
+	//It applies to a KeyedArchiveCodec without its own MaxDepth.
+	MaxPayloadDepth int
+	//PayloadCodec unarchives the payload, nil means DefaultPayloadCodec
+	PayloadCodec PayloadCodec
+	//DecompressPayload decompresses payloads whose header flags have PayloadFlagCompressionMask bits set and fails with
+	//ErrUnsupportedCompression for unknown bits. The flag values are unconfirmed, so without it the bits are ignored.
+	DecompressPayload bool
+	//LazyPayload leaves Payload nil instead of unarchiving it, use PayloadBytes or DecodePayload when it is needed
+	LazyPayload bool
+	//StrictAuxiliaryHeader fails with ErrAuxiliaryHeaderMismatch for frames whose AuxiliaryLayout is AuxiliaryLayoutMismatch.
+	//Without it those frames are decoded and only AuxiliaryLayout tells about the mismatch.
+	StrictAuxiliaryHeader bool
+	//KeepUnknownPrimitives keeps auxiliary entries with an unknown type tag as raw bytes instead of failing with an
+	//UnknownPrimitiveTypeError. Such entries are assumed to be length prefixed like binary entries.
+	KeepUnknownPrimitives bool
+}
+
+//ErrChecksumMismatch is returned if a frame does not match its trailing CRC
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+//ErrInconsistentPayloadHeader is returned if the lengths in the payload header do not fit each other or the MessageLength
+var ErrInconsistentPayloadHeader = errors.New("Inconsistent payload header")
+
+//ErrAuxiliaryHeaderMismatch is returned with DecodeOptions.StrictAuxiliaryHeader for auxiliary headers whose
+//AuxiliarySize does not fit the AuxiliaryLength
+var ErrAuxiliaryHeaderMismatch = errors.New("Auxiliary header does not match AuxiliaryLength")
+
+//ErrWrongMagic is returned for data that does not start with the DTX magic, meaning it is no DTX frame at all
+//or the stream is misaligned. Callers can skip ahead to the next magic to resync.
+var ErrWrongMagic = errors.New("Wrong Magic")
+
+//ErrShortBuffer is returned by Decode for buffers that do not even hold the 32 byte header, including nil and empty ones
+var ErrShortBuffer = errors.New("Buffer is shorter than the DTX header")
+
+//ErrIncompleteFrame is matched by errors.Is for an IncompleteFrameError
+var ErrIncompleteFrame = errors.New("Incomplete frame")
+
+//IncompleteFrameError is returned by Decode if the header is valid but the frame it announces is longer than the buffer.
+//Streaming callers should read at least Needed more bytes and decode again instead of dropping the data.
+type IncompleteFrameError struct {
+	Needed int
+}
+
+func (e *IncompleteFrameError) Error() string {
+	return fmt.Sprintf("Incomplete frame, %d more bytes needed", e.Needed)
+}
+
+//Is makes errors.Is(err, ErrIncompleteFrame) work for IncompleteFrameErrors
+func (e *IncompleteFrameError) Is(target error) bool {
+	return target == ErrIncompleteFrame
+}
+
+//ErrInvalidFragmentIndex is returned for frames whose FragmentIndex is not smaller than their Fragments
+var ErrInvalidFragmentIndex = errors.New("Invalid fragment index")
+
+//ErrBadHeaderLength is returned for frames with the right magic but a header length other than 32
+var ErrBadHeaderLength = errors.New("Incorrect Header length, should be 32")
+
+//DecodeStage tells which part of a frame Decode failed on
+type DecodeStage int
+
+const (
+	//StageMagic is the magic number at the start of the frame
+	StageMagic DecodeStage = iota
+	//StageHeader covers the routing header, the lengths it declares and the payload header
+	StageHeader
+	//StageAuxiliary covers the auxiliary header and entries
+	StageAuxiliary
+	//StagePayload is the archived payload
+	StagePayload
+	//StageChecksum is the trailing CRC of DecodeOptions.TrailingCRC
+	StageChecksum
+)
+
+func (s DecodeStage) String() string {
+	switch s {
+	case StageMagic:
+		return "magic"
+	case StageHeader:
+		return "header"
+	case StageAuxiliary:
+		return "auxiliary"
+	case StagePayload:
+		return "payload"
+	case StageChecksum:
+		return "checksum"
+	default:
+		return fmt.Sprintf("Unknown:%d", int(s))
+	}
+}
+
+//DecodeError is returned by Decode and its variants for all failures. Offset is the position of the offending bytes
+//relative to the start of the frame, for truncated frames it is the number of bytes that were available. Err is the
+//cause, so errors.Is and errors.As work with the sentinel errors and error types of this package.
+type DecodeError struct {
+	Offset int
+	Stage  DecodeStage
+	Err    error
+}
+
+func decodeError(stage DecodeStage, offset int, err error) error {
+	return &DecodeError{Offset: offset, Stage: stage, Err: err}
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("Decoding %s failed at offset %d: %v", e.Stage, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+//PayloadError is the cause of a DecodeError with StagePayload. Unlike for other errors, Decode
+//returns the message with the routing fields, headers and auxiliary set and only Payload missing, together with the
+//bytes following the frame, so the frame can be reported and skipped.
+type PayloadError struct {
+	Err error
 }
 
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("Failed decoding payload: %v", e.Err)
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+//Decode decodes the first frame of messageBytes and returns the bytes following it. The message aliases
+//messageBytes instead of copying: its raw and fragment bytes and binary auxiliary entries are slices of it, so
+//messageBytes must not be modified while the message is in use. Headers, integer auxiliary entries and the
+//decoded payload are copies. Use Clone to keep a message after reusing messageBytes.
 func Decode(messageBytes []byte) (DtxMessage, []byte, error) {
+	return DecodeWithOptions(messageBytes, DecodeOptions{})
+}
 
-	if binary.BigEndian.Uint32(messageBytes) != DtxMessageMagic {
-		return DtxMessage{}, make([]byte, 0), fmt.Errorf("Wrong Magic: %x", messageBytes[0:4])
+//DecodeWithOptions works like Decode but applies the given DecodeOptions.
+func DecodeWithOptions(messageBytes []byte, options DecodeOptions) (DtxMessage, []byte, error) {
+	msg, remainingBytes, err := decodeFrame(messageBytes, options)
+	var payloadError *PayloadError
+	if !options.TrailingCRC || (err != nil && !errors.As(err, &payloadError)) {
+		return msg, remainingBytes, err
+	}
+	//a frame with a PayloadError is still followed by its CRC, which has to be checked and skipped as well
+	frame := messageBytes[:len(messageBytes)-len(remainingBytes)]
+	if len(remainingBytes) < 4 {
+		return DtxMessage{}, make([]byte, 0), decodeError(StageChecksum, len(messageBytes),
+			fmt.Errorf("Missing trailing CRC after frame %s: %w", msg, &IncompleteFrameError{Needed: 4 - len(remainingBytes)}))
+	}
+	expected := binary.LittleEndian.Uint32(remainingBytes)
+	if actual := crc32.ChecksumIEEE(frame); actual != expected {
+		return DtxMessage{}, make([]byte, 0), decodeError(StageChecksum, len(frame),
+			fmt.Errorf("Frame %s has CRC %08x, expected %08x: %w", msg, actual, expected, ErrChecksumMismatch))
+	}
+	return msg, remainingBytes[4:], err
+}
+
+//DecodeN works like Decode but returns the number of bytes the frame takes up in messageBytes instead of the bytes
+//following it, which makes it easy to track offsets in a capture. n is 0 if decoding fails, unless the error is a
+//PayloadError.
+func DecodeN(messageBytes []byte) (msg DtxMessage, n int, err error) {
+	return DecodeNWithOptions(messageBytes, DecodeOptions{})
+}
+
+//DecodeNWithOptions works like DecodeN but applies the given DecodeOptions. With TrailingCRC n includes the CRC.
+func DecodeNWithOptions(messageBytes []byte, options DecodeOptions) (msg DtxMessage, n int, err error) {
+	msg, remainingBytes, err := DecodeWithOptions(messageBytes, options)
+	var payloadError *PayloadError
+	if err != nil && !errors.As(err, &payloadError) {
+		return DtxMessage{}, 0, err
+	}
+	return msg, len(messageBytes) - len(remainingBytes), err
+}
+
+//DecodeAll decodes all frames in messageBytes until the buffer is exhausted. If a frame cannot be decoded, for example
+//because a capture ends with a partial frame, the messages decoded before it are returned together with an error
+//telling how many bytes were left unconsumed.
+func DecodeAll(messageBytes []byte) ([]DtxMessage, error) {
+	return DecodeAllWithOptions(messageBytes, DecodeOptions{})
+}
+
+//DecodeAllWithOptions works like DecodeAll but applies the given DecodeOptions to every frame.
+func DecodeAllWithOptions(messageBytes []byte, options DecodeOptions) ([]DtxMessage, error) {
+	var result []DtxMessage
+	offset := 0
+	for offset < len(messageBytes) {
+		msg, n, err := DecodeNWithOptions(messageBytes[offset:], options)
+		if err != nil {
+			return result, fmt.Errorf("Failed decoding frame %d at offset %d, %d bytes left unconsumed: %w",
+				len(result), offset, len(messageBytes)-offset, err)
+		}
+		msg.Sequence = len(result)
+		result = append(result, msg)
+		offset += n
+	}
+	return result, nil
+}
+
+//DecodeInto works like Decode but fills dst instead of returning a new message, so messages can be pooled, for
+//example with a sync.Pool. dst is reset first and the value slices of its Auxiliary are reused if they are big enough.
+//Besides aliasing messageBytes like Decode, a message filled by DecodeInto shares its auxiliary slices with every
+//copy of it, so the caller must be done with the message and all copies of it before passing dst to DecodeInto
+//again, or Clone it. If decoding fails with anything but a PayloadError, dst is left reset.
+func DecodeInto(messageBytes []byte, dst *DtxMessage) ([]byte, error) {
+	dst.reset()
+	remainingBytes, err := decodeFrameInto(messageBytes, DecodeOptions{}, dst)
+	var payloadError *PayloadError
+	if err != nil && !errors.As(err, &payloadError) {
+		dst.reset()
+	}
+	return remainingBytes, err
+}
+
+//reset zeroes d but keeps the backing slices of its Auxiliary for reuse
+func (d *DtxMessage) reset() {
+	//keyValuePairs stays nil, it tells if the message has an auxiliary at all
+	auxiliary := DtxPrimitiveDictionary{values: d.Auxiliary.values[:0], valueTypes: d.Auxiliary.valueTypes[:0]}
+	*d = DtxMessage{Auxiliary: auxiliary}
+}
+
+func decodeFrame(messageBytes []byte, options DecodeOptions) (DtxMessage, []byte, error) {
+	var result DtxMessage
+	remainingBytes, err := decodeFrameInto(messageBytes, options, &result)
+	var payloadError *PayloadError
+	if err != nil && !errors.As(err, &payloadError) {
+		return DtxMessage{}, remainingBytes, err
+	}
+	return result, remainingBytes, err
+}
+
+//decodeFrameInto decodes a frame into result, which has to be reset by the caller
+func decodeFrameInto(messageBytes []byte, options DecodeOptions, result *DtxMessage) ([]byte, error) {
+	if len(messageBytes) < int(DtxHeaderLength) {
+		return make([]byte, 0), decodeError(StageHeader, len(messageBytes), fmt.Errorf("%w: got %d of %d bytes", ErrShortBuffer, len(messageBytes), DtxHeaderLength))
+	}
+	if !options.hasValidMagic(messageBytes) {
+		return make([]byte, 0), decodeError(StageMagic, 0, fmt.Errorf("%w: %x", ErrWrongMagic, messageBytes[0:4]))
 	}
 	if binary.LittleEndian.Uint32(messageBytes[4:]) != DtxHeaderLength {
-		return DtxMessage{}, make([]byte, 0), fmt.Errorf("Incorrect Header length, should be 32: %x", messageBytes[4:8])
+		return make([]byte, 0), decodeError(StageHeader, 4, fmt.Errorf("%w: %x", ErrBadHeaderLength, messageBytes[4:8]))
 	}
-	result := DtxMessage{}
 	result.FragmentIndex = binary.LittleEndian.Uint16(messageBytes[8:])
 	result.Fragments = binary.LittleEndian.Uint16(messageBytes[10:])
 	result.MessageLength = int(binary.LittleEndian.Uint32(messageBytes[12:]))
 	result.Identifier = int(binary.LittleEndian.Uint32(messageBytes[16:]))
-	result.ConversationIndex = int(binary.LittleEndian.Uint32(messageBytes[20:]))
-	result.ChannelCode = int(binary.LittleEndian.Uint32(messageBytes[24:]))
+	result.ConversationIndex = int(int32(binary.LittleEndian.Uint32(messageBytes[20:])))
+	//reply channels are negative
+	result.ChannelCode = int(int32(binary.LittleEndian.Uint32(messageBytes[24:])))
 
 	result.ExpectsReply = binary.LittleEndian.Uint32(messageBytes[28:]) == uint32(1)
+	if err := checkFragmentHeader(*result); err != nil {
+		return make([]byte, 0), decodeError(StageHeader, 8, err)
+	}
 
 	if result.IsFirstFragment() {
-		return result, messageBytes[32:], nil
+		result.rawBytes = messageBytes[:32]
+		return messageBytes[32:], nil
 	}
+	totalMessageLength := options.frameLength(result.MessageLength)
 	if result.IsFragment() {
-		result.fragmentBytes = messageBytes[32 : result.MessageLength+32]
-		return result, messageBytes[result.MessageLength+32:], nil
+		if totalMessageLength < 32 {
+			return make([]byte, 0), decodeError(StageHeader, 12, fmt.Errorf("Fragment %d of %d declares the invalid MessageLength %d",
+				result.FragmentIndex, result.Fragments, result.MessageLength))
+		}
+		if len(messageBytes) < totalMessageLength {
+			return make([]byte, 0), decodeError(StageHeader, len(messageBytes), fmt.Errorf("Fragment %d of %d declares MessageLength %d but only %d bytes are available: %w",
+				result.FragmentIndex, result.Fragments, result.MessageLength, len(messageBytes)-32, &IncompleteFrameError{Needed: totalMessageLength - len(messageBytes)}))
+		}
+		result.fragmentBytes = messageBytes[32:totalMessageLength]
+		result.rawBytes = messageBytes[:totalMessageLength]
+		return messageBytes[totalMessageLength:], nil
+	}
+	if totalMessageLength < 48 {
+		return make([]byte, 0), decodeError(StageHeader, 12, fmt.Errorf("Message declares MessageLength %d but at least 16 bytes are needed for the payload header",
+			result.MessageLength))
+	}
+	if len(messageBytes) < totalMessageLength {
+		return make([]byte, 0), decodeError(StageHeader, len(messageBytes), fmt.Errorf("Message declares MessageLength %d but only %d bytes are available: %w",
+			result.MessageLength, len(messageBytes)-32, &IncompleteFrameError{Needed: totalMessageLength - len(messageBytes)}))
 	}
 	ph, err := parsePayloadHeader(messageBytes[32:48])
 	if err != nil {
-		return DtxMessage{}, make([]byte, 0), err
+		return make([]byte, 0), decodeError(StageHeader, 32, err)
 	}
 	result.PayloadHeader = ph
+	payloadSpace := totalMessageLength - 48
+	if ph.AuxiliaryLength < 0 || ph.AuxiliaryLength > ph.TotalPayloadLength || ph.TotalPayloadLength > payloadSpace {
+		return make([]byte, 0), decodeError(StageHeader, 36, fmt.Errorf("%w: AuxiliaryLength %d and TotalPayloadLength %d do not fit the %d bytes after the payload header",
+			ErrInconsistentPayloadHeader, ph.AuxiliaryLength, ph.TotalPayloadLength, payloadSpace))
+	}
+	if result.HasAuxiliary() && ph.AuxiliaryLength < 16 {
+		return make([]byte, 0), decodeError(StageHeader, 36, fmt.Errorf("%w: AuxiliaryLength %d is too short for the 16 byte auxiliary header", ErrInconsistentPayloadHeader, ph.AuxiliaryLength))
+	}
 
 	if result.HasAuxiliary() {
 		header, err := parseAuxiliaryHeader(messageBytes[48:64])
 		if err != nil {
-			return DtxMessage{}, make([]byte, 0), err
+			return make([]byte, 0), decodeError(StageAuxiliary, 48, err)
 		}
 		result.AuxiliaryHeader = header
+		if options.StrictAuxiliaryHeader && result.AuxiliaryLayout() == AuxiliaryLayoutMismatch {
+			return make([]byte, 0), decodeError(StageAuxiliary, 56, fmt.Errorf("%w: AuxiliarySize %d (%s) and AuxiliaryLength %d",
+				ErrAuxiliaryHeaderMismatch, header.AuxiliarySize, header, ph.AuxiliaryLength))
+		}
 		auxBytes := messageBytes[64 : 48+result.PayloadHeader.AuxiliaryLength]
-		result.Auxiliary = decodeAuxiliary(auxBytes)
+		err = decodeAuxiliaryInto(auxBytes, options.KeepUnknownPrimitives, &result.Auxiliary)
+		if err != nil {
+			offset := 64
+			if unknown, ok := err.(*UnknownPrimitiveTypeError); ok {
+				offset += unknown.Offset
+			}
+			return make([]byte, 0), decodeError(StageAuxiliary, offset, err)
+		}
 	}
 
-	totalMessageLength := result.MessageLength + int(DtxHeaderLength)
 	result.rawBytes = messageBytes[:totalMessageLength]
-	if result.HasPayload() {
-		payload, err := result.parsePayloadBytes(result.rawBytes)
+	result.decompressPayload = options.DecompressPayload
+	if result.HasPayload() && !options.LazyPayload {
+		payload, err := result.parsePayloadBytes(options.payloadCodec())
 		if err != nil {
-			return DtxMessage{}, make([]byte, 0), err
+			return messageBytes[totalMessageLength:], decodeError(StagePayload, 48+result.PayloadHeader.AuxiliaryLength, &PayloadError{Err: err})
 		}
 		result.Payload = payload
 	}
 
-	remainingBytes := messageBytes[totalMessageLength:]
-	return result, remainingBytes, nil
+	return messageBytes[totalMessageLength:], nil
 }
 
-func parseAuxiliaryHeader(headerBytes []byte) (AuxiliaryHeader, error) {
-	r := bytes.NewReader(headerBytes)
-	var result AuxiliaryHeader
-	err := binary.Read(r, binary.LittleEndian, &result)
+//DecodeAt decodes the frame starting at offset off of r, reading only the bytes of that frame.
+//It returns the offset of the next frame. io.EOF is returned if off is at the end of r.
+func DecodeAt(r io.ReaderAt, off int64) (DtxMessage, int64, error) {
+	return DecodeAtWithOptions(r, off, DecodeOptions{})
+}
+
+//DecodeAtWithOptions works like DecodeAt but applies the given DecodeOptions, which also decide how many bytes
+//the frame takes up.
+func DecodeAtWithOptions(r io.ReaderAt, off int64, options DecodeOptions) (DtxMessage, int64, error) {
+	var header [32]byte
+	n, err := r.ReadAt(header[:], off)
+	if n == 0 && err == io.EOF {
+		return DtxMessage{}, off, io.EOF
+	}
+	if n < len(header) {
+		return DtxMessage{}, off, fmt.Errorf("Reading header at offset %d failed: %w", off, io.ErrUnexpectedEOF)
+	}
+	msg, err := parseHeaderArray(&header, options)
 	if err != nil {
-		return result, err
+		return DtxMessage{}, off, err
 	}
-	return result, nil
+	frameLength := options.wireLength(msg)
+	frame, err := readFrameBody(io.NewSectionReader(r, off+int64(len(header)), int64(frameLength-len(header))), header[:], frameLength, nil)
+	if err != nil {
+		return DtxMessage{}, off, fmt.Errorf("Reading frame of %d bytes at offset %d failed: %w", frameLength, off, err)
+	}
+	msg, _, err = DecodeWithOptions(frame, options)
+	if err != nil {
+		return DtxMessage{}, off, err
+	}
+	return msg, off + int64(frameLength), nil
+}
+
+func (o DecodeOptions) payloadCodec() PayloadCodec {
+	codec := o.PayloadCodec
+	if codec == nil {
+		codec = DefaultPayloadCodec
+	}
+	if keyed, ok := codec.(KeyedArchiveCodec); ok && keyed.MaxDepth == 0 {
+		keyed.MaxDepth = o.maxPayloadDepth()
+		return keyed
+	}
+	return codec
+}
+
+func (o DecodeOptions) maxPayloadDepth() int {
+	if o.MaxPayloadDepth == 0 {
+		return DefaultMaxPayloadDepth
+	}
+	return o.MaxPayloadDepth
+}
+
+//frameLength returns the number of bytes of a frame including the header
+func (o DecodeOptions) frameLength(messageLength int) int {
+	if o.MessageLengthIncludesHeader {
+		return messageLength
+	}
+	return messageLength + int(DtxHeaderLength)
+}
+
+//wireLength returns the number of bytes the frame with the given header takes up in a stream, including the trailing CRC
+func (o DecodeOptions) wireLength(header DtxMessage) int {
+	length := int(DtxHeaderLength)
+	if !header.IsFirstFragment() {
+		length = o.frameLength(header.MessageLength)
+	}
+	if o.TrailingCRC {
+		length += 4
+	}
+	return length
+}
+
+func (o DecodeOptions) hasValidMagic(messageBytes []byte) bool {
+	if binary.BigEndian.Uint32(messageBytes) == DtxMessageMagic {
+		return true
+	}
+	return o.AllowLittleEndianMagic && binary.LittleEndian.Uint32(messageBytes) == DtxMessageMagic
+}
+
+func parseAuxiliaryHeader(headerBytes []byte) (AuxiliaryHeader, error) {
+	if len(headerBytes) < 16 {
+		return AuxiliaryHeader{}, io.ErrUnexpectedEOF
+	}
+	//read the fields directly, binary.Read allocates for every call
+	return AuxiliaryHeader{
+		BufferSize:    binary.LittleEndian.Uint32(headerBytes),
+		Unknown:       binary.LittleEndian.Uint32(headerBytes[4:]),
+		AuxiliarySize: binary.LittleEndian.Uint32(headerBytes[8:]),
+		Unknown2:      binary.LittleEndian.Uint32(headerBytes[12:]),
+	}, nil
 }
 
 func parsePayloadHeader(messageBytes []byte) (DtxPayloadHeader, error) {
@@ -212,3 +780,19 @@ func parsePayloadHeader(messageBytes []byte) (DtxPayloadHeader, error) {
 
 	return result, nil
 }
+
+//DecodeExpectSelector decodes a single message like Decode and returns an error if the
+//selector in its payload is not the expected one.
+func DecodeExpectSelector(b []byte, selector string) (DtxMessage, error) {
+	msg, _, err := Decode(b)
+	if err != nil {
+		return msg, err
+	}
+	if !msg.HasPayload() {
+		return msg, fmt.Errorf("Expected selector '%s' but message has no payload: %s", selector, msg)
+	}
+	if actual, ok := msg.selector(); !ok || actual != selector {
+		return msg, fmt.Errorf("Expected selector '%s' but got '%v'", selector, msg.Payload[0])
+	}
+	return msg, nil
+}
@@ -1,6 +1,12 @@
 package dtx_test
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"io/ioutil"
 	"log"
 	"testing"
@@ -34,3 +40,714 @@ func TestDecoder(t *testing.T) {
 	}
 
 }
+
+func TestParseHeaderArray(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	var header [32]byte
+	copy(header[:], dat)
+	msg, err := dtx.ParseHeaderArray(&header)
+	if assert.NoError(t, err) {
+		decoded, _, err := dtx.Decode(dat)
+		assert.NoError(t, err)
+		assert.Equal(t, decoded.Identifier, msg.Identifier)
+		assert.Equal(t, decoded.MessageLength, msg.MessageLength)
+		assert.Equal(t, decoded.ChannelCode, msg.ChannelCode)
+		assert.Equal(t, decoded.ExpectsReply, msg.ExpectsReply)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		//a local array must stay on the stack
+		var local [32]byte
+		copy(local[:], dat)
+		dtx.ParseHeaderArray(&local)
+	})
+	assert.Equal(t, float64(0), allocs)
+}
+
+func BenchmarkParseHeaderArray(b *testing.B) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var header [32]byte
+		copy(header[:], dat)
+		dtx.ParseHeaderArray(&header)
+	}
+}
+
+func TestDecodeExpectSelector(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	msg, err := dtx.DecodeExpectSelector(dat, "_requestChannelWithCode:identifier:")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, msg.Identifier)
+	}
+	_, err = dtx.DecodeExpectSelector(dat, "_notifyOfPublishedCapabilities:")
+	assert.Error(t, err)
+}
+
+func TestDecodeLittleEndianMagic(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	dat[0], dat[1], dat[2], dat[3] = dat[3], dat[2], dat[1], dat[0]
+
+	_, _, err = dtx.Decode(dat)
+	assert.Error(t, err)
+
+	msg, remainingBytes, err := dtx.DecodeWithOptions(dat, dtx.DecodeOptions{AllowLittleEndianMagic: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, len(remainingBytes))
+		assert.Equal(t, "_requestChannelWithCode:identifier:", msg.Payload[0])
+	}
+}
+
+func TestDecodeTruncatedFragment(t *testing.T) {
+	fragment := make([]byte, 42)
+	binary.BigEndian.PutUint32(fragment, dtx.DtxMessageMagic)
+	binary.LittleEndian.PutUint32(fragment[4:], dtx.DtxHeaderLength)
+	binary.LittleEndian.PutUint16(fragment[8:], 1)
+	binary.LittleEndian.PutUint16(fragment[10:], 2)
+	binary.LittleEndian.PutUint32(fragment[12:], 100)
+
+	_, _, err := dtx.Decode(fragment)
+	assert.Error(t, err)
+}
+
+func TestAuxiliaryCount(t *testing.T) {
+	for _, fixture := range []string{"fixtures/notifyOfPublishedCapabilites", "fixtures/requestChannelWithCode"} {
+		dat, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			log.Fatal(err)
+		}
+		msg, _, err := dtx.Decode(dat)
+		if assert.NoError(t, err) {
+			count, err := msg.AuxiliaryCount()
+			assert.NoError(t, err)
+			assert.Equal(t, msg.Auxiliary.Len(), count)
+		}
+	}
+	count, err := dtx.DtxMessage{}.AuxiliaryCount()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestDecodeAt(t *testing.T) {
+	first, err := ioutil.ReadFile("fixtures/notifyOfPublishedCapabilites")
+	if err != nil {
+		log.Fatal(err)
+	}
+	second, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	reader := bytes.NewReader(append(append([]byte{}, first...), second...))
+
+	msg, next, err := dtx.DecodeAt(reader, 0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, msg.Identifier)
+		assert.Equal(t, int64(len(first)), next)
+	}
+	msg, next, err = dtx.DecodeAt(reader, next)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, msg.Identifier)
+		assert.Equal(t, int64(len(first)+len(second)), next)
+	}
+	_, _, err = dtx.DecodeAt(reader, next)
+	assert.Equal(t, io.EOF, err)
+
+	_, _, err = dtx.DecodeAt(bytes.NewReader(second[:100]), 0)
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+}
+
+func TestDecodeTrailingCRC(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	checksum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(dat))
+	withCRC := append(append([]byte{}, dat...), checksum...)
+	options := dtx.DecodeOptions{TrailingCRC: true}
+
+	msg, remainingBytes, err := dtx.DecodeWithOptions(withCRC, options)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, len(remainingBytes))
+		assert.Equal(t, 3, msg.Identifier)
+	}
+
+	withCRC[len(withCRC)-1]++
+	_, _, err = dtx.DecodeWithOptions(withCRC, options)
+	assert.True(t, errors.Is(err, dtx.ErrChecksumMismatch))
+
+	_, _, err = dtx.DecodeWithOptions(dat, options)
+	assert.Error(t, err)
+}
+
+func TestDecodeMessageLengthIncludesHeader(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	stream := append(append([]byte{}, dat...), dat...)
+	msg, remainingBytes, err := dtx.Decode(stream)
+	if assert.NoError(t, err) {
+		assert.Equal(t, len(dat), len(remainingBytes))
+		assert.Equal(t, "_requestChannelWithCode:identifier:", msg.Payload[0])
+	}
+
+	binary.LittleEndian.PutUint32(stream[12:], uint32(msg.MessageLength+32))
+	msg, remainingBytes, err = dtx.DecodeWithOptions(stream, dtx.DecodeOptions{MessageLengthIncludesHeader: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, len(dat), len(remainingBytes))
+		assert.Equal(t, "_requestChannelWithCode:identifier:", msg.Payload[0])
+	}
+}
+
+func TestDecodeAllSequence(t *testing.T) {
+	var stream []byte
+	for _, frame := range dtx.GenerateAckStream(3, 1) {
+		stream = append(stream, frame...)
+	}
+	msgs, err := dtx.DecodeAll(stream)
+	if assert.NoError(t, err) && assert.Equal(t, 3, len(msgs)) {
+		for i, msg := range msgs {
+			assert.Equal(t, i, msg.Sequence)
+		}
+	}
+	msgs, err = dtx.DecodeAll(stream[:48])
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(msgs)) {
+		assert.Equal(t, 0, msgs[0].Sequence)
+	}
+}
+
+func TestDecodeTruncatedFrames(t *testing.T) {
+	for _, fixture := range []string{"fixtures/notifyOfPublishedCapabilites", "fixtures/requestChannelWithCode"} {
+		dat, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			log.Fatal(err)
+		}
+		frames := append([][]byte{dat}, fragmentFrame(dat, 2)[1:]...)
+		for _, frame := range frames {
+			for length := 0; length < len(frame); length++ {
+				assert.NotPanics(t, func() {
+					_, _, err = dtx.Decode(frame[:length])
+				}, "%s truncated to %d bytes", fixture, length)
+				assert.Error(t, err, "%s truncated to %d bytes", fixture, length)
+			}
+		}
+	}
+}
+
+func TestDecodeInconsistentLengths(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, offset := range []int{36, 40} {
+		frame := append([]byte{}, dat...)
+		binary.LittleEndian.PutUint32(frame[offset:], uint32(len(frame)))
+		assert.NotPanics(t, func() {
+			_, _, err = dtx.Decode(frame)
+		})
+		assert.Error(t, err, "length at offset %d", offset)
+	}
+	frame := append([]byte{}, dat...)
+	binary.LittleEndian.PutUint32(frame[36:], 8)
+	_, _, err = dtx.Decode(frame)
+	assert.Error(t, err)
+}
+
+func TestDecodeSentinelErrors(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	misaligned := dat[1:]
+	_, _, err = dtx.Decode(misaligned)
+	assert.True(t, errors.Is(err, dtx.ErrWrongMagic), "unexpected error %v", err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("%x", misaligned[:4]))
+	var header [32]byte
+	copy(header[:], misaligned)
+	_, err = dtx.ParseHeaderArray(&header)
+	assert.True(t, errors.Is(err, dtx.ErrWrongMagic), "unexpected error %v", err)
+
+	badLength := append([]byte{}, dat...)
+	binary.LittleEndian.PutUint32(badLength[4:], 16)
+	_, _, err = dtx.Decode(badLength)
+	assert.True(t, errors.Is(err, dtx.ErrBadHeaderLength), "unexpected error %v", err)
+	assert.False(t, errors.Is(err, dtx.ErrWrongMagic))
+	copy(header[:], badLength)
+	_, err = dtx.ParseHeaderArray(&header)
+	assert.True(t, errors.Is(err, dtx.ErrBadHeaderLength), "unexpected error %v", err)
+}
+
+func TestDecodeNegativeChannel(t *testing.T) {
+	frame, err := dtx.Encode(dtx.NewKeepAlive(-3))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, uint32(0xfffffffd), binary.LittleEndian.Uint32(frame[24:]))
+	msg, _, err := dtx.Decode(frame)
+	if assert.NoError(t, err) {
+		assert.Equal(t, -3, msg.ChannelCode)
+	}
+	var header [32]byte
+	copy(header[:], frame)
+	msg, err = dtx.ParseHeaderArray(&header)
+	if assert.NoError(t, err) {
+		assert.Equal(t, -3, msg.ChannelCode)
+	}
+
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(dat[24:], 0xffffffff)
+	msg, _, err = dtx.Decode(dat)
+	if assert.NoError(t, err) {
+		assert.Equal(t, -1, msg.ChannelCode)
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	var capture []byte
+	for _, fixture := range []string{"fixtures/notifyOfPublishedCapabilites", "fixtures/requestChannelWithCode"} {
+		dat, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			log.Fatal(err)
+		}
+		capture = append(capture, dat...)
+	}
+	msgs, err := dtx.DecodeAll(capture)
+	if assert.NoError(t, err) && assert.Equal(t, 2, len(msgs)) {
+		assert.Equal(t, 2, msgs[0].Identifier)
+		assert.Equal(t, 3, msgs[1].Identifier)
+	}
+
+	partial := append(append([]byte{}, capture...), capture[:40]...)
+	msgs, err = dtx.DecodeAll(partial)
+	assert.Equal(t, 2, len(msgs))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "40 bytes left unconsumed")
+	}
+
+	msgs, err = dtx.DecodeAll(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, msgs)
+}
+
+func TestPayloadHeaderFlags(t *testing.T) {
+	//the captured frames leave the payload flags empty, even when the routing header expects a reply
+	notify := decodeFixture("fixtures/notifyOfPublishedCapabilites")
+	assert.False(t, notify.ExpectsReply)
+	assert.False(t, notify.PayloadHeader.ExpectsReply())
+	assert.False(t, notify.PayloadHeader.IsReply())
+
+	request := decodeFixture("fixtures/requestChannelWithCode")
+	assert.True(t, request.ExpectsReply)
+	assert.False(t, request.PayloadHeader.ExpectsReply())
+	assert.False(t, request.PayloadHeader.IsReply())
+}
+
+func TestRegisterMessageType(t *testing.T) {
+	name, ok := dtx.MessageTypeName(dtx.Ack)
+	assert.True(t, ok)
+	assert.Equal(t, "Ack", name)
+	messageType, ok := dtx.MessageTypeByName("Ack")
+	assert.True(t, ok)
+	assert.Equal(t, dtx.Ack, messageType)
+
+	msg := dtx.DtxMessage{PayloadHeader: dtx.DtxPayloadHeader{MessageType: 0x4242}}
+	_, ok = dtx.MessageTypeName(0x4242)
+	assert.False(t, ok)
+	_, ok = dtx.MessageTypeByName("test_type")
+	assert.False(t, ok)
+	assert.Contains(t, msg.String(), "t:Unknown:16962")
+
+	dtx.RegisterMessageType(0x4242, "test_type")
+	name, ok = dtx.MessageTypeName(0x4242)
+	assert.True(t, ok)
+	assert.Equal(t, "test_type", name)
+	messageType, ok = dtx.MessageTypeByName("test_type")
+	assert.True(t, ok)
+	assert.Equal(t, 0x4242, messageType)
+	assert.Contains(t, msg.String(), "t:test_type")
+}
+
+func TestDecodeInconsistentPayloadHeader(t *testing.T) {
+	aux := dtx.NewPrimitiveDictionary()
+	aux.AddInt32(1)
+	auxBytes, err := aux.Encode()
+	if err != nil {
+		log.Fatal(err)
+	}
+	valid := buildFrame(1, 1, auxBytes, archiveValue("selector:"))
+	_, _, err = dtx.Decode(valid)
+	assert.NoError(t, err)
+
+	for name, patch := range map[string]func(frame []byte){
+		"huge AuxiliaryLength": func(frame []byte) {
+			binary.LittleEndian.PutUint32(frame[36:], 0xFFFFFF)
+		},
+		"AuxiliaryLength above TotalPayloadLength": func(frame []byte) {
+			binary.LittleEndian.PutUint32(frame[40:], binary.LittleEndian.Uint32(frame[36:])-1)
+		},
+		"TotalPayloadLength beyond MessageLength": func(frame []byte) {
+			binary.LittleEndian.PutUint32(frame[40:], uint32(len(frame)))
+		},
+		"AuxiliaryLength without room for the auxiliary header": func(frame []byte) {
+			binary.LittleEndian.PutUint32(frame[36:], 8)
+		},
+	} {
+		frame := append([]byte{}, valid...)
+		patch(frame)
+		var msg dtx.DtxMessage
+		assert.NotPanics(t, func() { msg, _, err = dtx.Decode(frame) }, name)
+		assert.True(t, errors.Is(err, dtx.ErrInconsistentPayloadHeader), "%s: %v", name, err)
+		assert.Equal(t, 0, msg.Identifier, name)
+	}
+}
+
+func TestAuxiliaryLayout(t *testing.T) {
+	for _, fixture := range []string{"fixtures/notifyOfPublishedCapabilites", "fixtures/requestChannelWithCode"} {
+		assert.Equal(t, dtx.AuxiliaryLayoutEither, decodeFixture(fixture).AuxiliaryLayout(), fixture)
+	}
+	assert.Equal(t, dtx.AuxiliaryLayoutEither, dtx.NewKeepAlive(1).AuxiliaryLayout())
+
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	withUnknown2 := append([]byte{}, dat...)
+	binary.LittleEndian.PutUint32(withUnknown2[60:], 1)
+	msg, _, err := dtx.DecodeWithOptions(withUnknown2, dtx.DecodeOptions{StrictAuxiliaryHeader: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, dtx.AuxiliaryLayoutUint32, msg.AuxiliaryLayout())
+		assert.Equal(t, "uint32", msg.AuxiliaryLayout().String())
+	}
+
+	mismatch := append([]byte{}, dat...)
+	binary.LittleEndian.PutUint32(mismatch[56:], 1)
+	msg, _, err = dtx.Decode(mismatch)
+	if assert.NoError(t, err) {
+		assert.Equal(t, dtx.AuxiliaryLayoutMismatch, msg.AuxiliaryLayout())
+	}
+	_, _, err = dtx.DecodeWithOptions(mismatch, dtx.DecodeOptions{StrictAuxiliaryHeader: true})
+	assert.True(t, errors.Is(err, dtx.ErrAuxiliaryHeaderMismatch), "%v", err)
+}
+
+func TestMessageSemantics(t *testing.T) {
+	notify := decodeFixture("fixtures/notifyOfPublishedCapabilites")
+	request := decodeFixture("fixtures/requestChannelWithCode")
+	returnValue := request
+	returnValue.ConversationIndex = 1
+	returnValue.ExpectsReply = false
+	for _, c := range []struct {
+		name                                string
+		msg                                 dtx.DtxMessage
+		invocation, isRequest, reply, isAck bool
+	}{
+		{"notification", notify, true, false, false, false},
+		{"request", request, true, true, false, false},
+		{"return value", returnValue, false, false, true, false},
+		{"ack reply", dtx.BuildAck(3, 1, -2), false, false, true, true},
+		{"keep alive", dtx.NewKeepAlive(1), false, false, false, true},
+	} {
+		assert.Equal(t, c.invocation, c.msg.IsMethodInvocation(), c.name)
+		assert.Equal(t, c.isRequest, c.msg.IsRequest(), c.name)
+		assert.Equal(t, c.reply, c.msg.IsReply(), c.name)
+		assert.Equal(t, c.isAck, c.msg.IsAck(), c.name)
+	}
+}
+
+func TestRawBytes(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	msg, _, err := dtx.Decode(dat)
+	if !assert.NoError(t, err) {
+		return
+	}
+	raw := msg.RawBytes()
+	assert.Equal(t, dat, raw)
+	raw[0] = 0
+	assert.Equal(t, dat, msg.RawBytes(), "RawBytes returns a copy")
+	assert.Nil(t, msg.FragmentBytes())
+	assert.Nil(t, dtx.NewKeepAlive(1).RawBytes())
+
+	frames := fragmentFrame(dat, 2)
+	fragments := decodeFragments(frames)
+	assert.Equal(t, frames[0], fragments[0].RawBytes())
+	assert.Nil(t, fragments[0].FragmentBytes())
+	var body []byte
+	for i, fragment := range fragments[1:] {
+		assert.Equal(t, frames[i+1], fragment.RawBytes())
+		body = append(body, fragment.FragmentBytes()...)
+	}
+	assert.Equal(t, dat[32:], body)
+}
+
+func TestDecodeShortInput(t *testing.T) {
+	for _, input := range [][]byte{nil, {}, {0x79, 0x5b, 0x3d}} {
+		_, _, err := dtx.Decode(input)
+		assert.True(t, errors.Is(err, dtx.ErrShortBuffer), "%x: %v", input, err)
+	}
+
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, cut := range []int{32, 40, len(dat) - 1} {
+		_, _, err := dtx.Decode(dat[:cut])
+		assert.True(t, errors.Is(err, dtx.ErrIncompleteFrame), "%d: %v", cut, err)
+		var incomplete *dtx.IncompleteFrameError
+		if assert.True(t, errors.As(err, &incomplete)) {
+			assert.Equal(t, len(dat)-cut, incomplete.Needed)
+		}
+	}
+
+	fragments := fragmentFrame(dat, 2)
+	_, _, err = dtx.Decode(fragments[1][:len(fragments[1])-5])
+	var incomplete *dtx.IncompleteFrameError
+	if assert.True(t, errors.As(err, &incomplete)) {
+		assert.Equal(t, 5, incomplete.Needed)
+	}
+}
+
+func TestDecodeInto(t *testing.T) {
+	withAuxiliary, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	withoutAuxiliary, err := dtx.Encode(dtx.NewKeepAlive(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	var msg dtx.DtxMessage
+	for _, frame := range [][]byte{withAuxiliary, withoutAuxiliary, withAuxiliary} {
+		expected, _, err := dtx.Decode(frame)
+		if !assert.NoError(t, err) {
+			return
+		}
+		remainingBytes, err := dtx.DecodeInto(frame, &msg)
+		if assert.NoError(t, err) {
+			assert.Empty(t, remainingBytes)
+			assert.True(t, expected.Equal(msg), "%v", dtx.Diff(expected, msg))
+			expectedBytes, err := dtx.Encode(expected)
+			assert.NoError(t, err)
+			encoded, err := dtx.Encode(msg)
+			assert.NoError(t, err)
+			assert.Equal(t, expectedBytes, encoded)
+		}
+	}
+
+	_, err = dtx.DecodeInto(withAuxiliary[:40], &msg)
+	assert.True(t, errors.Is(err, dtx.ErrIncompleteFrame))
+	assert.Equal(t, 0, msg.Identifier)
+	assert.Equal(t, 0, msg.Auxiliary.Len())
+}
+
+func TestDecodeN(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fragments := fragmentFrame(dat, 3)
+	stream := append(append([]byte{}, dat...), bytes.Join(fragments, nil)...)
+	//a sub slice must not change the counts
+	stream = append([]byte{0, 0}, stream...)[2:]
+	expected := append([][]byte{dat}, fragments...)
+	offset := 0
+	for _, frame := range expected {
+		msg, n, err := dtx.DecodeN(stream[offset:])
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, len(frame), n)
+		assert.Equal(t, frame, msg.RawBytes())
+		offset += n
+	}
+	assert.Equal(t, len(stream), offset)
+
+	_, n, err := dtx.DecodeN(dat[:40])
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestDecodePayloadError(t *testing.T) {
+	var auxiliary dtx.DtxPrimitiveDictionary
+	auxiliary.AddInt32(7)
+	auxBytes, err := auxiliary.Encode()
+	if err != nil {
+		log.Fatal(err)
+	}
+	frame := buildFrame(42, 3, auxBytes, []byte("bplist00 is no archive"))
+	next := buildFrame(43, 3, nil, nil)
+
+	msg, remainingBytes, err := dtx.Decode(append(frame, next...))
+	var payloadError *dtx.PayloadError
+	if assert.True(t, errors.As(err, &payloadError), "%v", err) {
+		assert.Equal(t, 42, msg.Identifier)
+		assert.Equal(t, 3, msg.ChannelCode)
+		assert.Equal(t, []interface{}{int32(7)}, msg.Auxiliary.GetArguments())
+		assert.Nil(t, msg.Payload)
+		assert.Equal(t, next, remainingBytes)
+	}
+
+	msg, n, err := dtx.DecodeN(frame)
+	assert.True(t, errors.As(err, &payloadError))
+	assert.Equal(t, len(frame), n)
+	assert.Equal(t, 42, msg.Identifier)
+
+	_, _, err = dtx.Decode(frame[:len(frame)-1])
+	assert.False(t, errors.As(err, &payloadError))
+
+	//with trailing CRCs the checksum of the failed frame is verified and skipped, so decoding continues with the next frame
+	withCRC := func(frame []byte) []byte {
+		checksum := make([]byte, 4)
+		binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(frame))
+		return append(append([]byte{}, frame...), checksum...)
+	}
+	options := dtx.DecodeOptions{TrailingCRC: true}
+	stream := append(withCRC(frame), withCRC(next)...)
+	msg, remainingBytes, err = dtx.DecodeWithOptions(stream, options)
+	assert.True(t, errors.As(err, &payloadError), "%v", err)
+	assert.Equal(t, 42, msg.Identifier)
+	msg, remainingBytes, err = dtx.DecodeWithOptions(remainingBytes, options)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 43, msg.Identifier)
+		assert.Empty(t, remainingBytes)
+	}
+
+	stream[len(frame)]++
+	_, _, err = dtx.DecodeWithOptions(stream, options)
+	assert.True(t, errors.Is(err, dtx.ErrChecksumMismatch), "%v", err)
+}
+
+func TestDecodeError(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	corrupt := func(offset int, value uint32) []byte {
+		frame := append([]byte{}, dat...)
+		binary.LittleEndian.PutUint32(frame[offset:], value)
+		return frame
+	}
+	var auxiliary dtx.DtxPrimitiveDictionary
+	auxiliary.AddInt32(1)
+	auxBytes, err := auxiliary.Encode()
+	if err != nil {
+		log.Fatal(err)
+	}
+	unknownType := buildFrame(1, 1, append(auxBytes, 0x0a, 0, 0, 0, 0x42, 0, 0, 0), nil)
+	badPayload := buildFrame(1, 1, auxBytes, []byte("no archive"))
+
+	for _, test := range []struct {
+		name   string
+		frame  []byte
+		stage  dtx.DecodeStage
+		offset int
+		cause  error
+	}{
+		{"empty", nil, dtx.StageHeader, 0, dtx.ErrShortBuffer},
+		{"magic", corrupt(0, 0), dtx.StageMagic, 0, dtx.ErrWrongMagic},
+		{"header length", corrupt(4, 16), dtx.StageHeader, 4, dtx.ErrBadHeaderLength},
+		{"fragment index", corrupt(8, 0x00010005), dtx.StageHeader, 8, dtx.ErrInvalidFragmentIndex},
+		{"truncated", dat[:100], dtx.StageHeader, 100, dtx.ErrIncompleteFrame},
+		{"payload header", corrupt(36, 10000), dtx.StageHeader, 36, dtx.ErrInconsistentPayloadHeader},
+		{"auxiliary entry", unknownType, dtx.StageAuxiliary, 64 + len(auxBytes) + 4, nil},
+		{"payload", badPayload, dtx.StagePayload, 64 + len(auxBytes), nil},
+	} {
+		_, _, err := dtx.Decode(test.frame)
+		var decodeError *dtx.DecodeError
+		if !assert.True(t, errors.As(err, &decodeError), "%s: %v", test.name, err) {
+			continue
+		}
+		assert.Equal(t, test.stage, decodeError.Stage, test.name)
+		assert.Equal(t, test.offset, decodeError.Offset, test.name)
+		if test.cause != nil {
+			assert.True(t, errors.Is(err, test.cause), "%s: %v", test.name, err)
+		}
+	}
+
+	_, _, err = dtx.DecodeWithOptions(dat, dtx.DecodeOptions{TrailingCRC: true})
+	var decodeError *dtx.DecodeError
+	if assert.True(t, errors.As(err, &decodeError)) {
+		assert.Equal(t, dtx.StageChecksum, decodeError.Stage)
+		assert.Equal(t, "checksum", decodeError.Stage.String())
+	}
+	var unknown *dtx.UnknownPrimitiveTypeError
+	_, _, err = dtx.Decode(unknownType)
+	assert.True(t, errors.As(err, &unknown))
+}
+
+func TestDecodeOptionsStream(t *testing.T) {
+	var stream []byte
+	for _, fixture := range []string{"fixtures/notifyOfPublishedCapabilites", "fixtures/requestChannelWithCode"} {
+		dat, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			log.Fatal(err)
+		}
+		dat[0], dat[1], dat[2], dat[3] = dat[3], dat[2], dat[1], dat[0]
+		binary.LittleEndian.PutUint32(dat[12:], binary.LittleEndian.Uint32(dat[12:])+32)
+		checksum := make([]byte, 4)
+		binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(dat))
+		stream = append(append(stream, dat...), checksum...)
+	}
+	options := dtx.DecodeOptions{AllowLittleEndianMagic: true, TrailingCRC: true, MessageLengthIncludesHeader: true}
+	check := func(name string, msgs []dtx.DtxMessage, err error) {
+		if assert.NoError(t, err, name) && assert.Equal(t, 2, len(msgs), name) {
+			assert.Equal(t, 2, msgs[0].Identifier, name)
+			assert.Equal(t, "_requestChannelWithCode:identifier:", msgs[1].Payload[0], name)
+		}
+	}
+
+	_, err := dtx.DecodeAll(stream)
+	assert.Error(t, err)
+	msgs, err := dtx.DecodeAllWithOptions(stream, options)
+	check("DecodeAllWithOptions", msgs, err)
+
+	msgs, err = dtx.ReadCaptureWithOptions(bytes.NewReader(stream), options)
+	check("ReadCaptureWithOptions", msgs, err)
+
+	decoder := dtx.NewDecoder(bytes.NewReader(stream))
+	decoder.SetOptions(options)
+	msgs = nil
+	for {
+		msg, err := decoder.Decode()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			break
+		}
+		msgs = append(msgs, msg)
+	}
+	check("Decoder", msgs, nil)
+
+	msgs = nil
+	reader := bytes.NewReader(stream)
+	for off := int64(0); ; {
+		msg, next, err := dtx.DecodeAtWithOptions(reader, off, options)
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			break
+		}
+		msgs = append(msgs, msg)
+		off = next
+	}
+	check("DecodeAtWithOptions", msgs, nil)
+}
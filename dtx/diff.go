@@ -0,0 +1,166 @@
+package dtx
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+)
+
+//Diff lists the logical differences between two messages, an empty result means they are equal.
+//Lengths and raw bytes are not compared since Encode recomputes them. A Fragments value of 0 is treated like 1.
+//Numbers in the payload are compared by value, unarchiving returns an int archived by Encode as uint64.
+func Diff(a, b DtxMessage) []string {
+	var result []string
+	compare := func(field string, x, y interface{}) {
+		if !reflect.DeepEqual(x, y) {
+			result = append(result, fmt.Sprintf("%s: %v != %v", field, x, y))
+		}
+	}
+	compare("Fragments", effectiveFragments(a), effectiveFragments(b))
+	compare("FragmentIndex", a.FragmentIndex, b.FragmentIndex)
+	compare("Identifier", a.Identifier, b.Identifier)
+	compare("ConversationIndex", a.ConversationIndex, b.ConversationIndex)
+	compare("ChannelCode", a.ChannelCode, b.ChannelCode)
+	compare("ExpectsReply", a.ExpectsReply, b.ExpectsReply)
+	compare("MessageType", a.PayloadHeader.MessageType, b.PayloadHeader.MessageType)
+	compare("Flags", a.PayloadHeader.Flags, b.PayloadHeader.Flags)
+	if difference := auxiliaryDiff(a.Auxiliary, b.Auxiliary); difference != "" {
+		result = append(result, "Auxiliary: "+difference)
+	}
+	if !valuesEqual(a.Payload, b.Payload) {
+		result = append(result, fmt.Sprintf("Payload: %v != %v", a.Payload, b.Payload))
+	}
+	return result
+}
+
+//Equal tells if two messages are logically the same, see Diff for what is compared. Raw bytes and lengths are
+//ignored, so a decoded message equals the message it was encoded from.
+func (d DtxMessage) Equal(other DtxMessage) bool {
+	return len(Diff(d, other)) == 0
+}
+
+func effectiveFragments(d DtxMessage) uint16 {
+	if d.Fragments == 0 {
+		return 1
+	}
+	return d.Fragments
+}
+
+//auxiliaryDiff describes the first difference between two auxiliaries, an empty result means they are equal.
+//Only the differing entry is formatted. Binary entries with different bytes are still equal if they hold the same
+//archived objects.
+func auxiliaryDiff(a, b DtxPrimitiveDictionary) string {
+	if a.isPresent() != b.isPresent() {
+		return fmt.Sprintf("present %t != %t", a.isPresent(), b.isPresent())
+	}
+	if a.Len() != b.Len() {
+		return fmt.Sprintf("%d entries != %d", a.Len(), b.Len())
+	}
+	for i := range a.values {
+		if !auxiliaryEntryEqual(a, b, i) {
+			return fmt.Sprintf("entry %d: {t:%s, v:%s} != {t:%s, v:%s}", i,
+				toString(a.valueTypes[i]), a.entryString(i), toString(b.valueTypes[i]), b.entryString(i))
+		}
+	}
+	return ""
+}
+
+func auxiliaryEntryEqual(a, b DtxPrimitiveDictionary, i int) bool {
+	if a.valueTypes[i] != b.valueTypes[i] {
+		return false
+	}
+	switch x := a.values[i].(type) {
+	case DtxPrimitiveDictionary:
+		y, ok := b.values[i].(DtxPrimitiveDictionary)
+		return ok && auxiliaryDiff(x, y) == ""
+	case []byte:
+		y, ok := b.values[i].([]byte)
+		if !ok {
+			return false
+		}
+		if bytes.Equal(x, y) {
+			return true
+		}
+		objectX, errX := decodePayload(x, DefaultMaxPayloadDepth)
+		objectY, errY := decodePayload(y, DefaultMaxPayloadDepth)
+		return errX == nil && errY == nil && valuesEqual(objectX, objectY)
+	default:
+		return a.values[i] == b.values[i]
+	}
+}
+
+//valuesEqual works like reflect.DeepEqual but compares numbers of different types by their value
+func valuesEqual(x, y interface{}) bool {
+	switch a := x.(type) {
+	case []interface{}:
+		b, ok := y.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !valuesEqual(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := y.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for key, value := range a {
+			other, ok := b[key]
+			if !ok || !valuesEqual(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	if equal, ok := numbersEqual(x, y); ok {
+		return equal
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+//numbersEqual compares x and y if both are numbers, ok is false otherwise
+func numbersEqual(x, y interface{}) (equal bool, ok bool) {
+	vx, vy := reflect.ValueOf(x), reflect.ValueOf(y)
+	if !isNumber(vx.Kind()) || !isNumber(vy.Kind()) {
+		return false, false
+	}
+	switch {
+	case isFloat(vx.Kind()) || isFloat(vy.Kind()):
+		return toFloat(vx) == toFloat(vy), true
+	case isSigned(vx.Kind()) && isSigned(vy.Kind()):
+		return vx.Int() == vy.Int(), true
+	case isSigned(vx.Kind()):
+		return vx.Int() >= 0 && uint64(vx.Int()) == vy.Uint(), true
+	case isSigned(vy.Kind()):
+		return vy.Int() >= 0 && uint64(vy.Int()) == vx.Uint(), true
+	default:
+		return vx.Uint() == vy.Uint(), true
+	}
+}
+
+func isNumber(kind reflect.Kind) bool {
+	return isSigned(kind) || isFloat(kind) || kind >= reflect.Uint && kind <= reflect.Uintptr
+}
+
+func isSigned(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Int64
+}
+
+func isFloat(kind reflect.Kind) bool {
+	return kind == reflect.Float32 || kind == reflect.Float64
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case isFloat(v.Kind()):
+		return v.Float()
+	case isSigned(v.Kind()):
+		return float64(v.Int())
+	default:
+		return float64(v.Uint())
+	}
+}
@@ -0,0 +1,49 @@
+package dtx_test
+
+import (
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	msg := decodeFixture("fixtures/requestChannelWithCode")
+	assert.Empty(t, dtx.Diff(msg, msg))
+
+	other := msg
+	other.ChannelCode = 7
+	other.Payload = []interface{}{"other"}
+	assert.Equal(t, 2, len(dtx.Diff(msg, other)))
+}
+
+func TestEqual(t *testing.T) {
+	msg := decodeFixture("fixtures/requestChannelWithCode")
+	frame, err := dtx.Encode(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	reencoded, _, err := dtx.Decode(frame)
+	assert.NoError(t, err)
+	assert.True(t, msg.Equal(reencoded))
+
+	other := reencoded
+	other.Identifier++
+	assert.False(t, msg.Equal(other))
+	other = reencoded
+	other.Auxiliary = dtx.NewPrimitiveDictionary()
+	assert.False(t, msg.Equal(other))
+	other = reencoded
+	other.Auxiliary = dtx.DtxPrimitiveDictionary{}
+	assert.False(t, msg.Equal(other))
+
+	//an explicitly empty auxiliary is encoded, a missing one is not
+	empty := dtx.DtxMessage{Auxiliary: dtx.NewPrimitiveDictionary()}
+	diff := dtx.Diff(empty, dtx.DtxMessage{})
+	if assert.Equal(t, 1, len(diff)) {
+		assert.Contains(t, diff[0], "Auxiliary")
+	}
+	other = reencoded
+	other.Payload = []interface{}{"_requestChannelWithCode:"}
+	assert.False(t, msg.Equal(other))
+}
@@ -1,13 +1,13 @@
 package dtx
 
 import (
+	"bytes"
 	"container/list"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
-	"log"
-
-	archiver "github.com/danielpaulus/nskeyedarchiver"
+	"math"
+	"time"
 )
 
 // That is by far the weirdest concept I have ever seen.
@@ -28,82 +28,619 @@ type DtxPrimitiveKeyValuePair struct {
 	value     interface{}
 }
 
+//NewPrimitiveDictionary creates an empty dictionary. Unlike the zero value, it is encoded as an
+//explicitly empty auxiliary instead of no auxiliary at all.
+func NewPrimitiveDictionary() DtxPrimitiveDictionary {
+	return DtxPrimitiveDictionary{keyValuePairs: list.New()}
+}
+
+//isPresent tells if the dictionary was decoded from or should be encoded to a (possibly empty) auxiliary
+func (d DtxPrimitiveDictionary) isPresent() bool {
+	return d.keyValuePairs != nil
+}
+
+//String lists every entry with its type and a readable value. Archived objects are unarchived and shown as JSON,
+//archived dates and UUIDs in their usual text form, nested dictionaries are listed the same way and other binary
+//entries are shown as hex.
 func (d DtxPrimitiveDictionary) String() string {
 	result := "["
 	for i, v := range d.valueTypes {
-		var prettyString []byte
-		if v == bytearray {
-			bytes := d.values[i].([]byte)
-			prettyString = bytes
-			msg, err := archiver.Unarchive(bytes)
-			if err == nil {
-				prettyString, _ = json.Marshal(msg)
-			}
-			result += fmt.Sprintf("{t:%s, v:%s},\n", toString(v), prettyString)
-			continue
-		}
-		if v == t_uint32 {
-			result += fmt.Sprintf("{t:%s, v:%d},\n", toString(v), d.values[i])
-			continue
+		switch {
+		case v == null:
+			result += fmt.Sprintf("{t:%s},\n", toString(v))
+		case !isKnownType(v):
+			result += fmt.Sprintf("{t:%s(%d), v:%x},\n", toString(v), v, d.values[i])
+		default:
+			result += fmt.Sprintf("{t:%s, v:%s},\n", toString(v), d.entryString(i))
 		}
-		result += fmt.Sprintf("{t:%s, v:%s},\n", toString(v), d.values[i])
 	}
 	result += "]"
 	return result
 }
 
-func decodeAuxiliary(auxBytes []byte) DtxPrimitiveDictionary {
-	result := DtxPrimitiveDictionary{}
-	result.keyValuePairs = list.New()
-	for {
-		keyType, key, remainingBytes := readEntry(auxBytes)
+func (d DtxPrimitiveDictionary) entryString(index int) string {
+	value := d.values[index]
+	switch d.valueTypes[index] {
+	case t_uint32, t_int64:
+		return fmt.Sprintf("%d", value)
+	case t_double:
+		return fmt.Sprintf("%g", value)
+	case bytearray:
+		return binaryString(value.([]byte))
+	default:
+		return fmt.Sprintf("%s", value)
+	}
+}
+
+//binaryString renders a binary entry, trying the archived classes the nskeyedarchiver library cannot decode
+func binaryString(b []byte) string {
+	if msg, err := decodePayload(b, DefaultMaxPayloadDepth); err == nil {
+		if pretty, err := json.Marshal(msg); err == nil {
+			return string(pretty)
+		}
+		return fmt.Sprintf("%v", msg)
+	}
+	if date, err := unarchiveDate(b); err == nil {
+		return date.Format(time.RFC3339Nano)
+	}
+	if uuid, err := unarchiveUUID(b); err == nil {
+		return uuid
+	}
+	return fmt.Sprintf("%x", b)
+}
+
+//UnknownPrimitiveTypeError is returned when an auxiliary contains an entry with a type tag this package does not know.
+//Offset is the position of the entry relative to the end of the auxiliary header.
+type UnknownPrimitiveTypeError struct {
+	Type   uint32
+	Offset int
+}
+
+func (e *UnknownPrimitiveTypeError) Error() string {
+	return fmt.Sprintf("Unknown DtxPrimitiveDictionaryType %d at auxiliary offset %d", e.Type, e.Offset)
+}
+
+//decodeAuxiliary parses the entries following the auxiliary header. If keepUnknown is set, entries with an unknown
+//type tag are assumed to be length prefixed like binary entries and kept as raw bytes.
+func decodeAuxiliary(auxBytes []byte, keepUnknown bool) (DtxPrimitiveDictionary, error) {
+	var result DtxPrimitiveDictionary
+	err := decodeAuxiliaryInto(auxBytes, keepUnknown, &result)
+	if err != nil {
+		return DtxPrimitiveDictionary{}, err
+	}
+	return result, nil
+}
+
+//decodeAuxiliaryInto works like decodeAuxiliary but fills dst, reusing its value slices if they are big enough
+func decodeAuxiliaryInto(auxBytes []byte, keepUnknown bool, dst *DtxPrimitiveDictionary) error {
+	dst.keyValuePairs = list.New()
+	dst.values = dst.values[:0]
+	dst.valueTypes = dst.valueTypes[:0]
+	totalLength := len(auxBytes)
+	//an explicitly empty dictionary consists of only the AuxiliaryHeader
+	for len(auxBytes) > 0 {
+		keyType, key, remainingBytes, err := readEntry(auxBytes, keepUnknown)
+		if err != nil {
+			return withEntryOffset(err, totalLength-len(auxBytes))
+		}
 		auxBytes = remainingBytes
-		valueType, value, remainingBytes := readEntry(auxBytes)
+		valueType, value, remainingBytes, err := readEntry(auxBytes, keepUnknown)
+		if err != nil {
+			return withEntryOffset(err, totalLength-len(auxBytes))
+		}
 		auxBytes = remainingBytes
 		pair := DtxPrimitiveKeyValuePair{keyType, key, valueType, value}
-		result.keyValuePairs.PushBack(pair)
-		if len(auxBytes) == 0 {
-			break
+		dst.keyValuePairs.PushBack(pair)
+		dst.valueTypes = append(dst.valueTypes, valueType)
+		dst.values = append(dst.values, value)
+	}
+	return nil
+}
+
+//withEntryOffset moves the Offset of an UnknownPrimitiveTypeError from a position inside an entry to one in the
+//dictionary the entry starts at offset of
+func withEntryOffset(err error, offset int) error {
+	if unknown, ok := err.(*UnknownPrimitiveTypeError); ok {
+		return &UnknownPrimitiveTypeError{Type: unknown.Type, Offset: unknown.Offset + offset}
+	}
+	return err
+}
+
+//Type returns the PrimitiveType of the entry at index. Binary entries holding an archived NSData
+//are reported as TypeData, all other binary entries as TypeBytes.
+func (d DtxPrimitiveDictionary) Type(index int) (PrimitiveType, error) {
+	if index < 0 || index >= len(d.values) {
+		return 0, fmt.Errorf("Index %d out of range, dictionary has %d entries", index, len(d.values))
+	}
+	if d.valueTypes[index] == bytearray {
+		if _, err := unarchiveData(d.values[index].([]byte)); err == nil {
+			return TypeData, nil
 		}
 	}
+	return PrimitiveType(d.valueTypes[index]), nil
+}
+
+//GetBytes returns the raw bytes of a binary entry. It fails for entries containing an archived NSData, use GetData for those.
+func (d DtxPrimitiveDictionary) GetBytes(index int) ([]byte, error) {
+	t, err := d.Type(index)
+	if err != nil {
+		return nil, err
+	}
+	if t != TypeBytes {
+		return nil, fmt.Errorf("Entry %d is of type %s, not %s", index, t, TypeBytes)
+	}
+	return d.values[index].([]byte), nil
+}
+
+//GetData returns the contents of an archived NSData entry.
+func (d DtxPrimitiveDictionary) GetData(index int) ([]byte, error) {
+	archive, err := d.getBytes(index)
+	if err != nil {
+		return nil, err
+	}
+	return unarchiveData(archive)
+}
+
+//GetTime decodes the entry at index as an archived NSDate.
+func (d DtxPrimitiveDictionary) GetTime(index int) (time.Time, error) {
+	archive, err := d.getBytes(index)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return unarchiveDate(archive)
+}
+
+//GetUUID decodes the entry at index as an archived NSUUID and returns its canonical string form.
+func (d DtxPrimitiveDictionary) GetUUID(index int) (string, error) {
+	archive, err := d.getBytes(index)
+	if err != nil {
+		return "", err
+	}
+	return unarchiveUUID(archive)
+}
 
-	size := result.keyValuePairs.Len()
+//GetFlags returns the raw bits of an integer entry used as a bitfield of options, like launch flags.
+//No separate type tag for bitfields has been confirmed, so uint32 and int64 entries are accepted.
+func (d DtxPrimitiveDictionary) GetFlags(index int) (uint64, error) {
+	if err := d.checkType(index, t_uint32); err == nil {
+		return uint64(d.values[index].(uint32)), nil
+	}
+	if err := d.checkType(index, t_int64); err != nil {
+		return 0, err
+	}
+	return uint64(d.values[index].(int64)), nil
+}
 
-	result.valueTypes = make([]uint32, size)
-	result.values = make([]interface{}, size)
+//GetInt32 returns the value of a 32 bit integer entry, like the channel code of a channel request.
+func (d DtxPrimitiveDictionary) GetInt32(index int) (int32, error) {
+	if err := d.checkType(index, t_uint32); err != nil {
+		return 0, err
+	}
+	return int32(d.values[index].(uint32)), nil
+}
 
-	e := result.keyValuePairs.Front()
-	for i := 0; i < size; i++ {
-		result.valueTypes[i] = e.Value.(DtxPrimitiveKeyValuePair).valueType
-		result.values[i] = e.Value.(DtxPrimitiveKeyValuePair).value
+//GetInt64 returns the value of a 64 bit integer entry.
+func (d DtxPrimitiveDictionary) GetInt64(index int) (int64, error) {
+	if err := d.checkType(index, t_int64); err != nil {
+		return 0, err
 	}
+	return d.values[index].(int64), nil
+}
+
+//GetFloat64 returns the value of a double entry.
+func (d DtxPrimitiveDictionary) GetFloat64(index int) (float64, error) {
+	if err := d.checkType(index, t_double); err != nil {
+		return 0, err
+	}
+	return d.values[index].(float64), nil
+}
+
+//GetDictionary returns the nested DtxPrimitiveDictionary stored at index.
+func (d DtxPrimitiveDictionary) GetDictionary(index int) (DtxPrimitiveDictionary, error) {
+	if err := d.checkType(index, t_dictionary); err != nil {
+		return DtxPrimitiveDictionary{}, err
+	}
+	return d.values[index].(DtxPrimitiveDictionary), nil
+}
+
+//GetObject decodes the archived object stored at index. The unarchiver returns an archived empty NSArray as an
+//empty, non nil []interface{}, so it can be told apart from a null entry, for which GetObject returns nil.
+func (d DtxPrimitiveDictionary) GetObject(index int) (interface{}, error) {
+	if err := d.checkType(index, null); err == nil {
+		return nil, nil
+	}
+	return d.unarchive(index)
+}
+
+//GetNumber decodes an archived NSNumber. Depending on how the number was archived the result is a bool,
+//an int64 or a float64.
+func (d DtxPrimitiveDictionary) GetNumber(index int) (interface{}, error) {
+	archive, err := d.getBytes(index)
+	if err != nil {
+		return nil, err
+	}
+	return unarchiveNumber(archive)
+}
 
+//GetArguments returns all entries as Go values: int32 and int64 for integers, float64 for doubles, nil for null,
+//a DtxPrimitiveDictionary for nested dictionaries and the decoded object for archived ones. Binary entries
+//that cannot be unarchived are returned as []byte.
+func (d DtxPrimitiveDictionary) GetArguments() []interface{} {
+	result := make([]interface{}, len(d.values))
+	for i, value := range d.values {
+		switch d.valueTypes[i] {
+		case t_uint32:
+			result[i] = int32(value.(uint32))
+		case bytearray:
+			if object, err := d.GetObject(i); err == nil {
+				result[i] = object
+			} else {
+				result[i] = value
+			}
+		default:
+			result[i] = value
+		}
+	}
 	return result
 }
 
-func readEntry(auxBytes []byte) (uint32, interface{}, []byte) {
+//GetNSKeyedArchives decodes all binary entries as archived objects, skipping the primitive entries.
+func (d DtxPrimitiveDictionary) GetNSKeyedArchives() ([]interface{}, error) {
+	var result []interface{}
+	for i, valueType := range d.valueTypes {
+		if valueType != bytearray {
+			continue
+		}
+		object, err := d.GetObject(i)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, object)
+	}
+	return result, nil
+}
+
+func (d DtxPrimitiveDictionary) checkType(index int, expected uint32) error {
+	if index < 0 || index >= len(d.values) {
+		return fmt.Errorf("Index %d out of range, dictionary has %d entries", index, len(d.values))
+	}
+	if d.valueTypes[index] != expected {
+		return fmt.Errorf("Entry %d is of type %s, not %s", index, toString(d.valueTypes[index]), toString(expected))
+	}
+	return nil
+}
+
+//unarchive decodes the archived object stored at index
+func (d DtxPrimitiveDictionary) unarchive(index int) (interface{}, error) {
+	archive, err := d.getBytes(index)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := decodePayload(archive, DefaultMaxPayloadDepth)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) != 1 {
+		return nil, fmt.Errorf("Expected one archived object at index %d but got %d", index, len(objects))
+	}
+	return objects[0], nil
+}
+
+func (d DtxPrimitiveDictionary) getBytes(index int) ([]byte, error) {
+	if err := d.checkType(index, bytearray); err != nil {
+		return nil, err
+	}
+	return d.values[index].([]byte), nil
+}
+
+//AddNull appends a null argument, used for methods that receive an explicit nil.
+func (d *DtxPrimitiveDictionary) AddNull() {
+	d.add(null, nil)
+}
+
+//AddInt32 appends a 32 bit integer argument.
+func (d *DtxPrimitiveDictionary) AddInt32(value int32) {
+	d.add(t_uint32, uint32(value))
+}
+
+//AddInt64 appends a 64 bit integer argument.
+func (d *DtxPrimitiveDictionary) AddInt64(value int64) {
+	d.add(t_int64, value)
+}
+
+//AddFloat64 appends a double argument, services use these for values like sample rates.
+func (d *DtxPrimitiveDictionary) AddFloat64(value float64) {
+	d.add(t_double, value)
+}
+
+//AddBytes appends a binary argument, usually this is an nskeyedarchived object.
+func (d *DtxPrimitiveDictionary) AddBytes(value []byte) {
+	d.add(bytearray, value)
+}
+
+//AddData appends an NSData argument, in contrast to AddBytes the bytes are archived first.
+func (d *DtxPrimitiveDictionary) AddData(value []byte) error {
+	archive, err := archive([]interface{}{value})
+	if err != nil {
+		return err
+	}
+	d.add(bytearray, archive)
+	return nil
+}
+
+//AddObject appends an archived object argument like a string or a dictionary. There is no primitive type for
+//objects, they are binary entries holding the archive, which GetObject and GetArguments unarchive again.
+func (d *DtxPrimitiveDictionary) AddObject(value interface{}) error {
+	archive, err := archive([]interface{}{value})
+	if err != nil {
+		return err
+	}
+	d.add(bytearray, archive)
+	return nil
+}
+
+//AddDictionary appends a nested dictionary argument.
+func (d *DtxPrimitiveDictionary) AddDictionary(value DtxPrimitiveDictionary) {
+	d.add(t_dictionary, value)
+}
+
+//add appends a value with a null key, which is how all DTX messages we have seen use this dictionary.
+func (d *DtxPrimitiveDictionary) add(valueType uint32, value interface{}) {
+	if d.keyValuePairs == nil {
+		d.keyValuePairs = list.New()
+	}
+	d.keyValuePairs.PushBack(DtxPrimitiveKeyValuePair{null, nil, valueType, value})
+	d.valueTypes = append(d.valueTypes, valueType)
+	d.values = append(d.values, value)
+}
+
+//Encode serializes the dictionary into the byte format decodeAuxiliary reads. The AuxiliaryHeader is not included.
+//Entries holding a value that does not match their type cannot be represented and make Encode fail.
+func (d DtxPrimitiveDictionary) Encode() ([]byte, error) {
+	buf := new(bytes.Buffer)
+	if d.keyValuePairs == nil {
+		return buf.Bytes(), nil
+	}
+	for e := d.keyValuePairs.Front(); e != nil; e = e.Next() {
+		pair := e.Value.(DtxPrimitiveKeyValuePair)
+		err := writeEntry(buf, pair.keyType, pair.key)
+		if err != nil {
+			return nil, err
+		}
+		err = writeEntry(buf, pair.valueType, pair.value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func writeEntry(buf *bytes.Buffer, entryType uint32, value interface{}) error {
+	switch entryType {
+	case null:
+		binary.Write(buf, binary.LittleEndian, null)
+		return nil
+	case t_uint32:
+		if v, ok := value.(uint32); ok {
+			binary.Write(buf, binary.LittleEndian, t_uint32)
+			binary.Write(buf, binary.LittleEndian, v)
+			return nil
+		}
+	case t_int64:
+		if v, ok := value.(int64); ok {
+			binary.Write(buf, binary.LittleEndian, t_int64)
+			binary.Write(buf, binary.LittleEndian, v)
+			return nil
+		}
+	case t_double:
+		if v, ok := value.(float64); ok {
+			binary.Write(buf, binary.LittleEndian, t_double)
+			binary.Write(buf, binary.LittleEndian, v)
+			return nil
+		}
+	case t_dictionary:
+		if v, ok := value.(DtxPrimitiveDictionary); ok {
+			nested, err := v.Encode()
+			if err != nil {
+				return err
+			}
+			binary.Write(buf, binary.LittleEndian, t_dictionary)
+			binary.Write(buf, binary.LittleEndian, uint32(len(nested)))
+			buf.Write(nested)
+			return nil
+		}
+	case bytearray:
+		if v, ok := value.([]byte); ok {
+			binary.Write(buf, binary.LittleEndian, bytearray)
+			binary.Write(buf, binary.LittleEndian, uint32(len(v)))
+			buf.Write(v)
+			return nil
+		}
+	default:
+		//unknown entries kept by DecodeOptions.KeepUnknownPrimitives
+		if v, ok := value.([]byte); ok {
+			binary.Write(buf, binary.LittleEndian, entryType)
+			binary.Write(buf, binary.LittleEndian, uint32(len(v)))
+			buf.Write(v)
+			return nil
+		}
+	}
+	return fmt.Errorf("Cannot encode DtxPrimitiveDictionary entry of type %s with value %v", toString(entryType), value)
+}
+
+//encodedLength computes len(Encode()) without encoding the dictionary.
+func (d DtxPrimitiveDictionary) encodedLength() (int, error) {
+	if d.keyValuePairs == nil {
+		return 0, nil
+	}
+	length := 0
+	for e := d.keyValuePairs.Front(); e != nil; e = e.Next() {
+		pair := e.Value.(DtxPrimitiveKeyValuePair)
+		keyLength, err := entryLength(pair.keyType, pair.key)
+		if err != nil {
+			return 0, err
+		}
+		valueLength, err := entryLength(pair.valueType, pair.value)
+		if err != nil {
+			return 0, err
+		}
+		length += keyLength + valueLength
+	}
+	return length, nil
+}
+
+//entryLength must be kept in sync with writeEntry
+func entryLength(entryType uint32, value interface{}) (int, error) {
+	switch entryType {
+	case null:
+		return 4, nil
+	case t_uint32:
+		if _, ok := value.(uint32); ok {
+			return 8, nil
+		}
+	case t_int64:
+		if _, ok := value.(int64); ok {
+			return 12, nil
+		}
+	case t_double:
+		if _, ok := value.(float64); ok {
+			return 12, nil
+		}
+	case t_dictionary:
+		if v, ok := value.(DtxPrimitiveDictionary); ok {
+			nested, err := v.encodedLength()
+			return 8 + nested, err
+		}
+	case bytearray:
+		if v, ok := value.([]byte); ok {
+			return 8 + len(v), nil
+		}
+	default:
+		if v, ok := value.([]byte); ok {
+			return 8 + len(v), nil
+		}
+	}
+	return 0, fmt.Errorf("Cannot encode DtxPrimitiveDictionary entry of type %s with value %v", toString(entryType), value)
+}
+
+//Len returns the number of arguments stored in the dictionary.
+func (d DtxPrimitiveDictionary) Len() int {
+	return len(d.values)
+}
+
+//countAuxiliaryEntries walks the key value pairs of encoded auxiliary bytes without decoding the values.
+func countAuxiliaryEntries(auxBytes []byte) (int, error) {
+	count := 0
+	for len(auxBytes) > 0 {
+		for i := 0; i < 2; i++ {
+			remaining, err := skipEntry(auxBytes)
+			if err != nil {
+				return 0, err
+			}
+			auxBytes = remaining
+		}
+		count++
+	}
+	return count, nil
+}
+
+func skipEntry(auxBytes []byte) ([]byte, error) {
+	if len(auxBytes) < 4 {
+		return nil, fmt.Errorf("Auxiliary entry truncated: %x", auxBytes)
+	}
+	readType := binary.LittleEndian.Uint32(auxBytes)
+	switch {
+	case readType == null:
+		return auxBytes[4:], nil
+	case readType == t_uint32 && len(auxBytes) >= 8:
+		return auxBytes[8:], nil
+	case (readType == t_int64 || readType == t_double) && len(auxBytes) >= 12:
+		return auxBytes[12:], nil
+	case hasLength(readType) && len(auxBytes) >= 8:
+		length := binary.LittleEndian.Uint32(auxBytes[4:])
+		if uint64(len(auxBytes)-8) < uint64(length) {
+			return nil, fmt.Errorf("Auxiliary entry of length %d exceeds remaining %d bytes", length, len(auxBytes)-8)
+		}
+		return auxBytes[8+length:], nil
+	}
+	return nil, fmt.Errorf("Cannot skip auxiliary entry of type %d: %x", readType, auxBytes)
+}
+
+func readEntry(auxBytes []byte, keepUnknown bool) (uint32, interface{}, []byte, error) {
+	if len(auxBytes) < 4 {
+		return 0, nil, nil, fmt.Errorf("Auxiliary entry truncated: %x", auxBytes)
+	}
 	readType := binary.LittleEndian.Uint32(auxBytes)
 	if readType == null {
-		return null, nil, auxBytes[4:]
+		return null, nil, auxBytes[4:], nil
+	}
+	if readType == t_uint32 && len(auxBytes) >= 8 {
+		return t_uint32, binary.LittleEndian.Uint32(auxBytes[4:8]), auxBytes[8:], nil
+	}
+	if readType == t_int64 && len(auxBytes) >= 12 {
+		return t_int64, int64(binary.LittleEndian.Uint64(auxBytes[4:12])), auxBytes[12:], nil
 	}
-	if readType == t_uint32 {
-		return t_uint32, auxBytes[4:8], auxBytes[8:]
+	if readType == t_double && len(auxBytes) >= 12 {
+		return t_double, math.Float64frombits(binary.LittleEndian.Uint64(auxBytes[4:12])), auxBytes[12:], nil
 	}
-	if hasLength(readType) {
+	known := isKnownType(readType)
+	if (hasLength(readType) || !known && keepUnknown) && len(auxBytes) >= 8 {
 		length := binary.LittleEndian.Uint32(auxBytes[4:])
+		if uint64(len(auxBytes)-8) < uint64(length) {
+			return 0, nil, nil, fmt.Errorf("Auxiliary entry of length %d exceeds remaining %d bytes", length, len(auxBytes)-8)
+		}
 		data := auxBytes[8 : 8+length]
-		return readType, data, auxBytes[8+length:]
+		if readType == t_dictionary {
+			nested, err := decodeAuxiliary(data, keepUnknown)
+			return readType, nested, auxBytes[8+length:], withEntryOffset(err, 8)
+		}
+		return readType, data, auxBytes[8+length:], nil
 	}
-	log.Fatalf("Unknown DtxPrimitiveDictionaryType: %d  rawbytes:%x", readType, auxBytes)
-	return 0, nil, nil
+	if !known {
+		return 0, nil, nil, &UnknownPrimitiveTypeError{Type: readType}
+	}
+	return 0, nil, nil, fmt.Errorf("Auxiliary entry of type %s truncated: %x", toString(readType), auxBytes)
+}
+
+func isKnownType(typeCode uint32) bool {
+	switch typeCode {
+	case null, bytearray, t_uint32, t_int64, t_double, t_dictionary:
+		return true
+	}
+	return false
 }
 
 const (
 	null      uint32 = 0x0A
 	bytearray uint32 = 0x02
 	t_uint32  uint32 = 0x03
+	t_int64   uint32 = 0x06
+	t_double  uint32 = 0x09
+	//a nested DtxPrimitiveDictionary, length prefixed like bytearray
+	t_dictionary uint32 = 0x0B
 )
 
+//PrimitiveType tells what kind of value a DtxPrimitiveDictionary entry holds
+type PrimitiveType uint32
+
+const (
+	TypeNull       = PrimitiveType(null)
+	TypeBytes      = PrimitiveType(bytearray)
+	TypeUint32     = PrimitiveType(t_uint32)
+	TypeInt64      = PrimitiveType(t_int64)
+	TypeFloat64    = PrimitiveType(t_double)
+	TypeDictionary = PrimitiveType(t_dictionary)
+	//TypeData is not a separate type tag on the wire, it is a binary entry that contains an archived NSData
+	TypeData PrimitiveType = 0x10002
+)
+
+func (t PrimitiveType) String() string {
+	if t == TypeData {
+		return "data"
+	}
+	return toString(uint32(t))
+}
+
 func toString(t uint32) string {
 	switch t {
 	case null:
@@ -112,11 +649,17 @@ func toString(t uint32) string {
 		return "binary"
 	case t_uint32:
 		return "uint32"
+	case t_int64:
+		return "int64"
+	case t_double:
+		return "float64"
+	case t_dictionary:
+		return "dictionary"
 	default:
 		return "unknown"
 	}
 }
 
 func hasLength(typeCode uint32) bool {
-	return typeCode == bytearray
+	return typeCode == bytearray || typeCode == t_dictionary
 }
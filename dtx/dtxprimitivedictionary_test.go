@@ -0,0 +1,458 @@
+package dtx_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrimitiveDictionaryNullRoundTrip(t *testing.T) {
+	aux := dtx.DtxPrimitiveDictionary{}
+	aux.AddInt32(5)
+	aux.AddNull()
+	aux.AddBytes([]byte{1, 2, 3})
+	auxBytes, err := aux.Encode()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	msg, _, err := dtx.Decode(buildFrame(1, 1, auxBytes, nil))
+	if assert.NoError(t, err) {
+		assert.Equal(t, aux.String(), msg.Auxiliary.String())
+		reencoded, err := msg.Auxiliary.Encode()
+		assert.NoError(t, err)
+		assert.Equal(t, auxBytes, reencoded)
+	}
+}
+
+func TestPrimitiveDictionaryGetTime(t *testing.T) {
+	aux := dtx.DtxPrimitiveDictionary{}
+	aux.AddInt32(1)
+	aux.AddBytes(archiveObject("NSDate", map[string]interface{}{"NS.time": 600000000.5}))
+
+	date, err := aux.GetTime(1)
+	if assert.NoError(t, err) {
+		expected := time.Date(2020, time.January, 6, 10, 40, 0, 500000000, time.UTC)
+		assert.True(t, expected.Equal(date), "expected %s but got %s", expected, date)
+	}
+	_, err = aux.GetTime(0)
+	assert.Error(t, err)
+	_, err = aux.GetTime(2)
+	assert.Error(t, err)
+
+	//NSDate.distantFuture and NSDate.distantPast are far outside the range of a time.Duration
+	aux = dtx.DtxPrimitiveDictionary{}
+	aux.AddBytes(archiveObject("NSDate", map[string]interface{}{"NS.time": 63113904000.0}))
+	aux.AddBytes(archiveObject("NSDate", map[string]interface{}{"NS.time": -63114076800.0}))
+	aux.AddBytes(archiveObject("NSDate", map[string]interface{}{"NS.time": -0.25}))
+	for i, expected := range []time.Time{
+		time.Date(4001, time.January, 1, 0, 0, 0, 0, time.UTC),
+		//Foundation counts January 1st of year 1 in the Julian calendar, Go in the proleptic Gregorian one
+		time.Date(0, time.December, 30, 0, 0, 0, 0, time.UTC),
+		time.Date(2000, time.December, 31, 23, 59, 59, 750000000, time.UTC),
+	} {
+		date, err := aux.GetTime(i)
+		if assert.NoError(t, err) {
+			assert.True(t, expected.Equal(date), "expected %s but got %s", expected, date)
+		}
+	}
+}
+
+func TestEmptyAuxiliary(t *testing.T) {
+	frame, err := dtx.Encode(dtx.DtxMessage{Identifier: 1, Auxiliary: dtx.NewPrimitiveDictionary(), Payload: []interface{}{"selector"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg, _, err := dtx.Decode(frame)
+	if assert.NoError(t, err) {
+		assert.True(t, msg.HasAuxiliary())
+		assert.Equal(t, 16, msg.PayloadHeader.AuxiliaryLength)
+		assert.Equal(t, 0, msg.Auxiliary.Len())
+		reencoded, err := dtx.Encode(msg)
+		assert.NoError(t, err)
+		assert.Equal(t, frame, reencoded)
+	}
+
+	frame, err = dtx.Encode(dtx.DtxMessage{Identifier: 1, Payload: []interface{}{"selector"}})
+	if assert.NoError(t, err) {
+		msg, _, err := dtx.Decode(frame)
+		assert.NoError(t, err)
+		assert.False(t, msg.HasAuxiliary())
+	}
+}
+
+func TestPrimitiveDictionaryNested(t *testing.T) {
+	nested := dtx.DtxPrimitiveDictionary{}
+	nested.AddInt32(7)
+	nested.AddBytes([]byte("nested"))
+	aux := dtx.DtxPrimitiveDictionary{}
+	aux.AddInt32(1)
+	aux.AddDictionary(nested)
+	auxBytes, err := aux.Encode()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	msg, _, err := dtx.Decode(buildFrame(1, 1, auxBytes, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	decoded, err := msg.Auxiliary.GetDictionary(1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, decoded.Len())
+		assert.Equal(t, nested.String(), decoded.String())
+	}
+	_, err = msg.Auxiliary.GetDictionary(0)
+	assert.Error(t, err)
+}
+
+func TestPrimitiveDictionaryGetUUID(t *testing.T) {
+	uuidBytes := []byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	aux := dtx.DtxPrimitiveDictionary{}
+	aux.AddBytes(archiveObject("NSUUID", map[string]interface{}{"NS.uuidbytes": uuidBytes}))
+	aux.AddBytes(archiveObject("NSDate", map[string]interface{}{"NS.time": 1.0}))
+
+	uuid, err := aux.GetUUID(0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "12345678-9ABC-DEF0-0123-456789ABCDEF", uuid)
+	}
+	_, err = aux.GetUUID(1)
+	assert.Error(t, err)
+}
+
+func TestPrimitiveDictionaryGetFlags(t *testing.T) {
+	aux := dtx.DtxPrimitiveDictionary{}
+	aux.AddInt64(1<<40 | 0x5)
+	aux.AddInt32(3)
+	aux.AddNull()
+	auxBytes, err := aux.Encode()
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg, _, err := dtx.Decode(buildFrame(1, 1, auxBytes, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	flags, err := msg.Auxiliary.GetFlags(0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(1<<40|0x5), flags)
+	}
+	flags, err = msg.Auxiliary.GetFlags(1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint64(3), flags)
+	}
+	_, err = msg.Auxiliary.GetFlags(2)
+	assert.Error(t, err)
+	count, err := msg.AuxiliaryCount()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func TestPrimitiveDictionaryBytesAndData(t *testing.T) {
+	aux := dtx.DtxPrimitiveDictionary{}
+	aux.AddBytes([]byte{1, 2, 3})
+	assert.NoError(t, aux.AddData([]byte{4, 5, 6}))
+	aux.AddBytes(archiveObject("NSMutableData", map[string]interface{}{"NS.data": []byte{7, 8}}))
+
+	types := []dtx.PrimitiveType{}
+	for i := 0; i < aux.Len(); i++ {
+		ty, err := aux.Type(i)
+		assert.NoError(t, err)
+		types = append(types, ty)
+	}
+	assert.Equal(t, []dtx.PrimitiveType{dtx.TypeBytes, dtx.TypeData, dtx.TypeData}, types)
+
+	raw, err := aux.GetBytes(0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte{1, 2, 3}, raw)
+	}
+	_, err = aux.GetBytes(1)
+	assert.Error(t, err)
+
+	data, err := aux.GetData(1)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte{4, 5, 6}, data)
+	}
+	data, err = aux.GetData(2)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte{7, 8}, data)
+	}
+	_, err = aux.GetData(0)
+	assert.Error(t, err)
+}
+
+func TestPrimitiveDictionaryGetObjectEmptyArray(t *testing.T) {
+	aux := dtx.DtxPrimitiveDictionary{}
+	aux.AddBytes(archiveObject("NSArray", map[string]interface{}{"NS.objects": []interface{}{}}))
+	aux.AddNull()
+	auxBytes, err := aux.Encode()
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg, _, err := dtx.Decode(buildFrame(1, 1, auxBytes, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	empty, err := msg.Auxiliary.GetObject(0)
+	if assert.NoError(t, err) {
+		assert.NotNil(t, empty)
+		assert.Equal(t, []interface{}{}, empty)
+	}
+	null, err := msg.Auxiliary.GetObject(1)
+	assert.NoError(t, err)
+	assert.Nil(t, null)
+}
+
+func TestPrimitiveDictionaryGetNumber(t *testing.T) {
+	aux := dtx.NewPrimitiveDictionary()
+	aux.AddBytes(archiveValue(true))
+	aux.AddBytes(archiveValue(42))
+	aux.AddBytes(archiveValue(-3))
+	aux.AddBytes(archiveValue(2.5))
+	aux.AddBytes(archiveValue("not a number"))
+	auxBytes, err := aux.Encode()
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg, _, err := dtx.Decode(buildFrame(1, 1, auxBytes, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i, expected := range []interface{}{true, int64(42), int64(-3), 2.5} {
+		number, err := msg.Auxiliary.GetNumber(i)
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, number)
+		}
+	}
+	_, err = msg.Auxiliary.GetNumber(4)
+	assert.Error(t, err)
+}
+
+func TestPrimitiveDictionaryEncodeFromScratch(t *testing.T) {
+	nested := dtx.NewPrimitiveDictionary()
+	nested.AddInt64(-1)
+	aux := dtx.NewPrimitiveDictionary()
+	aux.AddInt32(-7)
+	aux.AddInt64(1 << 40)
+	aux.AddBytes(archiveValue("com.apple.instruments.server.services.sysmontap"))
+	aux.AddBytes([]byte{0xde, 0xad})
+	aux.AddNull()
+	aux.AddDictionary(nested)
+	auxBytes, err := aux.Encode()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	msg, _, err := dtx.Decode(buildFrame(1, 1, auxBytes, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	decoded := msg.Auxiliary
+	assert.Equal(t, aux.Len(), decoded.Len())
+	assert.Equal(t, aux.String(), decoded.String())
+	for i := 0; i < aux.Len(); i++ {
+		expected, _ := aux.Type(i)
+		actual, err := decoded.Type(i)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual, "type of entry %d", i)
+	}
+	small, err := decoded.GetFlags(0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(0xfffffff9), small)
+	large, err := decoded.GetInt64(1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1<<40), large)
+	object, err := decoded.GetObject(2)
+	assert.NoError(t, err)
+	assert.Equal(t, "com.apple.instruments.server.services.sysmontap", object)
+	raw, err := decoded.GetBytes(3)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xde, 0xad}, raw)
+	inner, err := decoded.GetDictionary(5)
+	if assert.NoError(t, err) {
+		value, err := inner.GetInt64(0)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(-1), value)
+	}
+	_, err = decoded.GetInt64(0)
+	assert.Error(t, err)
+
+	reencoded, err := decoded.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, auxBytes, reencoded)
+}
+
+func TestPrimitiveDictionaryArguments(t *testing.T) {
+	aux := decodeFixture("fixtures/requestChannelWithCode").Auxiliary
+	identifier := "dtxproxy:XCTestManager_IDEInterface:XCTestManager_DaemonConnectionInterface"
+
+	assert.Equal(t, []interface{}{int32(1), identifier}, aux.GetArguments())
+	archives, err := aux.GetNSKeyedArchives()
+	if assert.NoError(t, err) {
+		assert.Equal(t, []interface{}{identifier}, archives)
+	}
+	code, err := aux.GetInt32(0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, int32(1), code)
+	}
+	_, err = aux.GetInt32(1)
+	assert.Error(t, err)
+	_, err = aux.GetInt32(2)
+	assert.Error(t, err)
+
+	capabilities, err := decodeFixture("fixtures/notifyOfPublishedCapabilites").Auxiliary.GetNSKeyedArchives()
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(capabilities)) {
+		assert.Equal(t, uint64(2), capabilities[0].(map[string]interface{})["com.apple.private.DTXBlockCompression"])
+	}
+}
+
+func TestPrimitiveDictionary64BitValues(t *testing.T) {
+	//an auxiliary as sent by a sampling service: a timestamp, a sample rate and an int32 after them,
+	//which is only read correctly if the 8 byte values are not taken for two 32 bit fields
+	auxBytes := []byte{
+		0x0a, 0x00, 0x00, 0x00, 0x06, 0x00, 0x00, 0x00, 0x00, 0x10, 0xa5, 0xd4, 0xe8, 0x00, 0x00, 0x00,
+		0x0a, 0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x70, 0xe7, 0x40,
+		0x0a, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00,
+	}
+	msg, _, err := dtx.Decode(buildFrame(1, 1, auxBytes, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	aux := msg.Auxiliary
+	assert.Equal(t, 3, aux.Len())
+	timestamp, err := aux.GetInt64(0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1000000000000), timestamp)
+	rate, err := aux.GetFloat64(1)
+	assert.NoError(t, err)
+	assert.Equal(t, 48000.0, rate)
+	value, err := aux.GetInt32(2)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(5), value)
+	valueType, err := aux.Type(1)
+	assert.NoError(t, err)
+	assert.Equal(t, dtx.TypeFloat64, valueType)
+	assert.Equal(t, "float64", valueType.String())
+	assert.Equal(t, []interface{}{int64(1000000000000), 48000.0, int32(5)}, aux.GetArguments())
+	assert.Contains(t, aux.String(), "{t:float64, v:48000}")
+	_, err = aux.GetFloat64(0)
+	assert.Error(t, err)
+
+	reencoded, err := aux.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, auxBytes, reencoded)
+
+	built := dtx.NewPrimitiveDictionary()
+	built.AddInt64(1000000000000)
+	built.AddFloat64(48000)
+	built.AddInt32(5)
+	encoded, err := built.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, auxBytes, encoded)
+	count, err := msg.AuxiliaryCount()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	_, _, err = dtx.Decode(buildFrame(1, 1, auxBytes[:28], nil))
+	assert.Error(t, err)
+}
+
+func TestPrimitiveDictionaryUnknownType(t *testing.T) {
+	//an int32, then an entry of the unknown type 0x0D carrying 3 bytes, then a null inside a nested dictionary
+	auxBytes := []byte{
+		0x0a, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00,
+		0x0a, 0x00, 0x00, 0x00, 0x0d, 0x00, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x01, 0x02, 0x03,
+		0x0a, 0x00, 0x00, 0x00, 0x0a, 0x00, 0x00, 0x00,
+	}
+	frame := buildFrame(1, 1, auxBytes, nil)
+	var msg dtx.DtxMessage
+	var err error
+	assert.NotPanics(t, func() { msg, _, err = dtx.Decode(frame) })
+	var unknown *dtx.UnknownPrimitiveTypeError
+	if assert.True(t, errors.As(err, &unknown), "%v", err) {
+		assert.Equal(t, uint32(0x0d), unknown.Type)
+		assert.Equal(t, 16, unknown.Offset)
+	}
+
+	msg, _, err = dtx.DecodeWithOptions(frame, dtx.DecodeOptions{KeepUnknownPrimitives: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 3, msg.Auxiliary.Len())
+	valueType, err := msg.Auxiliary.Type(1)
+	assert.NoError(t, err)
+	assert.Equal(t, dtx.PrimitiveType(0x0d), valueType)
+	assert.Equal(t, []interface{}{int32(5), []byte{1, 2, 3}, nil}, msg.Auxiliary.GetArguments())
+	assert.Contains(t, msg.Auxiliary.String(), "{t:unknown(13), v:010203}")
+	reencoded, err := msg.Auxiliary.Encode()
+	assert.NoError(t, err)
+	assert.Equal(t, auxBytes, reencoded)
+
+	nested := dtx.NewPrimitiveDictionary()
+	nested.AddInt32(1)
+	nestedBytes, err := nested.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	//turn the int32 of the nested dictionary into an unknown type without a length prefix
+	nestedBytes[4] = 0x0e
+	outer := append([]byte{0x0a, 0x00, 0x00, 0x00, 0x0b, 0x00, 0x00, 0x00, byte(len(nestedBytes)), 0x00, 0x00, 0x00}, nestedBytes...)
+	_, _, err = dtx.Decode(buildFrame(1, 1, outer, nil))
+	if assert.True(t, errors.As(err, &unknown), "%v", err) {
+		assert.Equal(t, uint32(0x0e), unknown.Type)
+		assert.Equal(t, 16, unknown.Offset)
+	}
+}
+
+func TestPrimitiveDictionaryString(t *testing.T) {
+	nested := dtx.NewPrimitiveDictionary()
+	nested.AddBytes(archiveValue("inner"))
+	aux := dtx.NewPrimitiveDictionary()
+	aux.AddNull()
+	aux.AddInt32(-3)
+	aux.AddInt64(0x11)
+	aux.AddBytes(archiveValue(map[string]interface{}{"ur": 1000}))
+	aux.AddBytes(archiveObject("NSDate", map[string]interface{}{"NS.time": 600000000.5}))
+	aux.AddBytes(archiveObject("NSUUID", map[string]interface{}{
+		"NS.uuidbytes": []byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}}))
+	aux.AddBytes([]byte{0xde, 0xad})
+	aux.AddDictionary(nested)
+
+	assert.Equal(t, "[{t:null},\n"+
+		"{t:uint32, v:4294967293},\n"+
+		"{t:int64, v:17},\n"+
+		"{t:binary, v:[{\"ur\":1000}]},\n"+
+		"{t:binary, v:2020-01-06T10:40:00.5Z},\n"+
+		"{t:binary, v:12345678-9ABC-DEF0-0123-456789ABCDEF},\n"+
+		"{t:binary, v:dead},\n"+
+		"{t:dictionary, v:[{t:binary, v:[\"inner\"]},\n]},\n]", aux.String())
+}
+
+func TestPrimitiveDictionaryObjects(t *testing.T) {
+	config := map[string]interface{}{"ur": uint64(500), "bm": uint64(0)}
+	aux := dtx.NewPrimitiveDictionary()
+	assert.NoError(t, aux.AddObject("com.apple.instruments.server.services.deviceinfo"))
+	assert.NoError(t, aux.AddObject(config))
+	assert.Error(t, aux.AddObject(make(chan int)))
+	assert.Equal(t, 2, aux.Len())
+
+	msg, err := dtx.BuildMethodInvocation("setConfig:", 3, []interface{}{"com.apple.instruments.server.services.deviceinfo", config}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, aux.String(), msg.Auxiliary.String())
+	encoded, err := dtx.Encode(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	decoded, _, err := dtx.Decode(encoded)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []interface{}{"com.apple.instruments.server.services.deviceinfo", config}, decoded.Auxiliary.GetArguments())
+		object, err := decoded.Auxiliary.GetObject(1)
+		assert.NoError(t, err)
+		assert.Equal(t, config, object)
+	}
+}
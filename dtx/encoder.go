@@ -0,0 +1,285 @@
+package dtx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+)
+
+//defaultAuxiliaryBufferSize is the BufferSize all captured frames with small auxiliaries use
+const defaultAuxiliaryBufferSize = 496
+
+//Encode serializes msg into a single, non fragmented DTX frame.
+//MessageLength, AuxiliaryLength and TotalPayloadLength are computed from Auxiliary and Payload,
+//the values stored in the struct are ignored. An auxiliary set with SetRawAuxiliary is written verbatim.
+//Messages with inconsistent fragment fields are rejected, see Validate.
+func Encode(msg DtxMessage) ([]byte, error) {
+	return AppendEncode(nil, msg)
+}
+
+//AppendEncode appends the encoded frame for msg to dst and returns the extended buffer, like strconv.AppendInt.
+func AppendEncode(dst []byte, msg DtxMessage) ([]byte, error) {
+	if err := msg.Validate(); err != nil {
+		return dst, err
+	}
+	var auxBytes []byte
+	var err error
+	if msg.rawAuxiliary == nil {
+		auxBytes, err = msg.Auxiliary.Encode()
+		if err != nil {
+			return dst, err
+		}
+	}
+	var payloadBytes []byte
+	if len(msg.Payload) > 0 {
+		payloadBytes, err = DefaultPayloadCodec.Archive(msg.Payload)
+		if err != nil {
+			return dst, err
+		}
+	}
+	auxiliaryLength := 0
+	switch {
+	case msg.rawAuxiliary != nil:
+		auxiliaryLength = len(msg.rawAuxiliary)
+	case msg.Auxiliary.isPresent():
+		auxiliaryLength = 16 + len(auxBytes)
+	}
+	totalPayloadLength := auxiliaryLength + len(payloadBytes)
+
+	dst = appendRoutingHeader(dst, msg, 0, 1, 16+totalPayloadLength)
+
+	dst = appendUint32(dst, binary.LittleEndian, uint32(msg.PayloadHeader.MessageType))
+	dst = appendUint32(dst, binary.LittleEndian, uint32(auxiliaryLength))
+	dst = appendUint32(dst, binary.LittleEndian, uint32(totalPayloadLength))
+	flags := msg.PayloadHeader.Flags
+	if msg.WasCompressed() {
+		//the payload is archived again uncompressed
+		flags &^= PayloadFlagCompressionMask
+	}
+	dst = appendUint32(dst, binary.LittleEndian, uint32(flags))
+
+	if msg.rawAuxiliary != nil {
+		dst = append(dst, msg.rawAuxiliary...)
+	} else if auxiliaryLength > 0 {
+		msg.PayloadHeader.AuxiliaryLength = auxiliaryLength
+		msg.SyncAuxiliaryHeader()
+		dst = appendUint32(dst, binary.LittleEndian, msg.AuxiliaryHeader.BufferSize)
+		dst = appendUint32(dst, binary.LittleEndian, msg.AuxiliaryHeader.Unknown)
+		dst = appendUint32(dst, binary.LittleEndian, msg.AuxiliaryHeader.AuxiliarySize)
+		dst = appendUint32(dst, binary.LittleEndian, msg.AuxiliaryHeader.Unknown2)
+		dst = append(dst, auxBytes...)
+	}
+	return append(dst, payloadBytes...), nil
+}
+
+//Validate checks that the fragment fields of a message describe the single frame Encode writes: Fragments set to 1,
+//or left at 0, and FragmentIndex 0. Encode does not write fragments, split messages with EncodeFragmented instead.
+func (d DtxMessage) Validate() error {
+	if d.Fragments > 1 || d.FragmentIndex > 0 {
+		return fmt.Errorf("FragmentIndex %d and Fragments %d describe a fragment, Encode only writes single frames, use EncodeFragmented",
+			d.FragmentIndex, d.Fragments)
+	}
+	return nil
+}
+
+//SetRawAuxiliary makes Encode write b as the auxiliary section instead of serializing Auxiliary and AuxiliaryHeader,
+//which keeps the section byte exact when forwarding. b is the complete section of AuxiliaryLength bytes including the
+//16 byte auxiliary header, as it appears in a captured frame. Passing nil goes back to serializing Auxiliary.
+func (d *DtxMessage) SetRawAuxiliary(b []byte) {
+	if b == nil {
+		d.rawAuxiliary = nil
+		return
+	}
+	d.rawAuxiliary = append([]byte{}, b...)
+}
+
+//SyncAuxiliaryHeader derives the AuxiliaryHeader from PayloadHeader.AuxiliaryLength. The unknown fields
+//are set to zero and BufferSize to the value devices use for small auxiliaries, or the AuxiliarySize if it does not fit.
+//Encode calls this, so it is only needed when the header is inspected before encoding.
+func (d *DtxMessage) SyncAuxiliaryHeader() {
+	if d.PayloadHeader.AuxiliaryLength < 16 {
+		d.AuxiliaryHeader = AuxiliaryHeader{}
+		return
+	}
+	auxiliarySize := uint32(d.PayloadHeader.AuxiliaryLength - 16)
+	bufferSize := uint32(defaultAuxiliaryBufferSize)
+	if bufferSize < auxiliarySize {
+		bufferSize = auxiliarySize
+	}
+	d.AuxiliaryHeader = AuxiliaryHeader{BufferSize: bufferSize, AuxiliarySize: auxiliarySize}
+}
+
+//EncodedSize returns len(Encode(msg)). The auxiliary is only measured, the payload however has to be
+//archived because the size of a binary plist cannot be known upfront.
+func EncodedSize(msg DtxMessage) (int, error) {
+	if err := msg.Validate(); err != nil {
+		return 0, err
+	}
+	size := int(DtxHeaderLength) + 16
+	if msg.rawAuxiliary != nil {
+		size += len(msg.rawAuxiliary)
+	} else if msg.Auxiliary.isPresent() {
+		auxiliaryLength, err := msg.Auxiliary.encodedLength()
+		if err != nil {
+			return 0, err
+		}
+		size += 16 + auxiliaryLength
+	}
+	if len(msg.Payload) > 0 {
+		payloadBytes, err := DefaultPayloadCodec.Archive(msg.Payload)
+		if err != nil {
+			return 0, err
+		}
+		size += len(payloadBytes)
+	}
+	return size, nil
+}
+
+//EncodeAll encodes all messages and concatenates the frames.
+func EncodeAll(msgs []DtxMessage) ([]byte, error) {
+	var result []byte
+	for _, msg := range msgs {
+		frame, err := Encode(msg)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, frame...)
+	}
+	return result, nil
+}
+
+//EncodeFragmented encodes msg like Encode and splits the frame into fragments carrying at most maxFragmentSize
+//bytes after their 32 byte header. The first fragment only consists of a header announcing the total length,
+//it is followed by the fragments holding the data, as devices send them. A message that fits into maxFragmentSize
+//is returned as a single, non fragmented frame.
+func EncodeFragmented(msg DtxMessage, maxFragmentSize int) ([][]byte, error) {
+	if maxFragmentSize <= 0 {
+		return nil, fmt.Errorf("Invalid fragment size %d", maxFragmentSize)
+	}
+	msg.Fragments = 1
+	msg.FragmentIndex = 0
+	frame, err := Encode(msg)
+	if err != nil {
+		return nil, err
+	}
+	body := frame[DtxHeaderLength:]
+	if len(body) <= maxFragmentSize {
+		return [][]byte{frame}, nil
+	}
+	parts := (len(body) + maxFragmentSize - 1) / maxFragmentSize
+	if parts+1 > 0xFFFF {
+		return nil, fmt.Errorf("Message of %d bytes needs %d fragments of %d bytes, at most %d are possible", len(body), parts+1, maxFragmentSize, 0xFFFF)
+	}
+	fragments := uint16(parts + 1)
+	result := make([][]byte, 0, fragments)
+	result = append(result, appendRoutingHeader(nil, msg, 0, fragments, len(body)))
+	for i := 0; i < parts; i++ {
+		end := (i + 1) * maxFragmentSize
+		if end > len(body) {
+			end = len(body)
+		}
+		part := body[i*maxFragmentSize : end]
+		fragment := appendRoutingHeader(make([]byte, 0, int(DtxHeaderLength)+len(part)), msg, uint16(i+1), fragments, len(part))
+		result = append(result, append(fragment, part...))
+	}
+	return result, nil
+}
+
+//WriteTo encodes the message and writes the frame to w. It implements io.WriterTo and returns the number of
+//bytes written, also if writing fails midway.
+func (d DtxMessage) WriteTo(w io.Writer) (int64, error) {
+	return d.WriteFragmentedTo(w, 0)
+}
+
+//WriteFragmentedTo works like WriteTo but splits the message into fragments of at most maxFragmentSize bytes
+//after the header, see EncodeFragmented. With a maxFragmentSize of 0 the message is written as a single frame.
+func (d DtxMessage) WriteFragmentedTo(w io.Writer, maxFragmentSize int) (int64, error) {
+	var frames [][]byte
+	if maxFragmentSize != 0 {
+		var err error
+		frames, err = EncodeFragmented(d, maxFragmentSize)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		frame, err := Encode(d)
+		if err != nil {
+			return 0, err
+		}
+		frames = [][]byte{frame}
+	}
+	var written int64
+	for _, frame := range frames {
+		n, err := writeFull(w, frame)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+//appendRoutingHeader appends the 32 byte header of msg with the given fragment fields and MessageLength
+func appendRoutingHeader(dst []byte, msg DtxMessage, fragmentIndex uint16, fragments uint16, messageLength int) []byte {
+	dst = appendUint32(dst, binary.BigEndian, DtxMessageMagic)
+	dst = appendUint32(dst, binary.LittleEndian, DtxHeaderLength)
+	dst = appendUint16(dst, fragmentIndex)
+	dst = appendUint16(dst, fragments)
+	dst = appendUint32(dst, binary.LittleEndian, uint32(messageLength))
+	dst = appendUint32(dst, binary.LittleEndian, uint32(msg.Identifier))
+	dst = appendUint32(dst, binary.LittleEndian, uint32(msg.ConversationIndex))
+	dst = appendUint32(dst, binary.LittleEndian, uint32(msg.ChannelCode))
+	expectsReply := uint32(0)
+	if msg.ExpectsReply {
+		expectsReply = 1
+	}
+	return appendUint32(dst, binary.LittleEndian, expectsReply)
+}
+
+func appendUint32(dst []byte, order binary.ByteOrder, v uint32) []byte {
+	var b [4]byte
+	order.PutUint32(b[:], v)
+	return append(dst, b[:]...)
+}
+
+func appendUint16(dst []byte, v uint16) []byte {
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	return append(dst, b[:]...)
+}
+
+//VerifyEncode encodes msg, decodes the result and returns an error describing all differences to msg.
+func VerifyEncode(msg DtxMessage) error {
+	frame, err := Encode(msg)
+	if err != nil {
+		return err
+	}
+	decoded, _, err := Decode(frame)
+	if err != nil {
+		return fmt.Errorf("Encoded message cannot be decoded: %v", err)
+	}
+	if diff := Diff(msg, decoded); len(diff) > 0 {
+		return fmt.Errorf("Encoded message differs after decoding: %s", strings.Join(diff, ", "))
+	}
+	return nil
+}
+
+//ReconstructStream concatenates the frames of msgs. Decoded messages contribute the exact bytes they were
+//decoded from, so ReconstructStream(DecodeAll(b)) reproduces b. Changing the fields of a decoded message does not
+//change those bytes. Messages that were built instead of decoded are encoded.
+func ReconstructStream(msgs []DtxMessage) ([]byte, error) {
+	var result []byte
+	for _, msg := range msgs {
+		if msg.rawBytes != nil {
+			result = append(result, msg.rawBytes...)
+			continue
+		}
+		var err error
+		result, err = AppendEncode(result, msg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,327 @@
+package dtx_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeFixture(name string) dtx.DtxMessage {
+	dat, err := ioutil.ReadFile(name)
+	if err != nil {
+		log.Fatal(err)
+	}
+	msg, _, err := dtx.Decode(dat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return msg
+}
+
+func TestAppendEncode(t *testing.T) {
+	first := decodeFixture("fixtures/notifyOfPublishedCapabilites")
+	second := decodeFixture("fixtures/requestChannelWithCode")
+
+	buf, err := dtx.AppendEncode(nil, first)
+	assert.NoError(t, err)
+	buf, err = dtx.AppendEncode(buf, second)
+	assert.NoError(t, err)
+
+	all, err := dtx.EncodeAll([]dtx.DtxMessage{first, second})
+	assert.NoError(t, err)
+	assert.Equal(t, all, buf)
+
+	msg, remainingBytes, err := dtx.Decode(buf)
+	if assert.NoError(t, err) {
+		assert.Equal(t, first.Payload, msg.Payload)
+		assert.Equal(t, first.Auxiliary.String(), msg.Auxiliary.String())
+	}
+	msg, remainingBytes, err = dtx.Decode(remainingBytes)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, len(remainingBytes))
+		assert.Equal(t, second.String(), msg.String())
+		assert.Equal(t, second.Payload, msg.Payload)
+	}
+}
+
+func benchmarkMessages() []dtx.DtxMessage {
+	msg := decodeFixture("fixtures/requestChannelWithCode")
+	msgs := make([]dtx.DtxMessage, 100)
+	for i := range msgs {
+		msgs[i] = msg
+	}
+	return msgs
+}
+
+func BenchmarkEncodeAll(b *testing.B) {
+	msgs := benchmarkMessages()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		dtx.EncodeAll(msgs)
+	}
+}
+
+func BenchmarkAppendEncode(b *testing.B) {
+	msgs := benchmarkMessages()
+	var buf []byte
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = buf[:0]
+		for _, msg := range msgs {
+			buf, _ = dtx.AppendEncode(buf, msg)
+		}
+	}
+}
+
+func TestEncodeRoundTrip(t *testing.T) {
+	aux := dtx.NewPrimitiveDictionary()
+	aux.AddInt32(11)
+	aux.AddBytes(archiveValue("com.apple.instruments.server.services.deviceinfo"))
+	//only logical fields are set, the stale lengths must be ignored
+	msg := dtx.DtxMessage{
+		Identifier:        7,
+		ConversationIndex: 1,
+		ChannelCode:       3,
+		ExpectsReply:      true,
+		MessageLength:     9999,
+		PayloadHeader:     dtx.DtxPayloadHeader{MessageType: dtx.MethodInvocationWithExpectedReply, AuxiliaryLength: 1, TotalPayloadLength: 2},
+		Auxiliary:         aux,
+		Payload:           []interface{}{"runningProcesses"},
+	}
+	frame, err := dtx.Encode(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, dtx.DtxMessageMagic, binary.BigEndian.Uint32(frame))
+	assert.Equal(t, dtx.DtxHeaderLength, binary.LittleEndian.Uint32(frame[4:]))
+	assert.Equal(t, uint16(0), binary.LittleEndian.Uint16(frame[8:]))
+	assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(frame[10:]))
+	assert.Equal(t, uint32(len(frame)-32), binary.LittleEndian.Uint32(frame[12:]))
+
+	decoded, remainingBytes, err := dtx.Decode(frame)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 0, len(remainingBytes))
+		assert.Empty(t, dtx.Diff(msg, decoded))
+		assert.Equal(t, len(frame)-32, decoded.MessageLength)
+		assert.Equal(t, decoded.PayloadHeader.AuxiliaryLength+decoded.PayloadLength(), decoded.PayloadHeader.TotalPayloadLength)
+		identifier, err := decoded.Auxiliary.GetObject(1)
+		assert.NoError(t, err)
+		assert.Equal(t, "com.apple.instruments.server.services.deviceinfo", identifier)
+	}
+}
+
+func TestSyncAuxiliaryHeader(t *testing.T) {
+	aux := dtx.DtxPrimitiveDictionary{}
+	aux.AddInt32(1)
+	msg := dtx.DtxMessage{Identifier: 1, Auxiliary: aux, AuxiliaryHeader: dtx.AuxiliaryHeader{Unknown: 5, Unknown2: 7}}
+	msg.PayloadHeader.AuxiliaryLength = 16 + 12
+	msg.SyncAuxiliaryHeader()
+	assert.Equal(t, dtx.AuxiliaryHeader{BufferSize: 496, AuxiliarySize: 12}, msg.AuxiliaryHeader)
+
+	frame, err := dtx.Encode(msg)
+	if assert.NoError(t, err) {
+		decoded, _, err := dtx.Decode(frame)
+		assert.NoError(t, err)
+		assert.Equal(t, msg.AuxiliaryHeader, decoded.AuxiliaryHeader)
+		assert.Equal(t, msg.PayloadHeader.AuxiliaryLength, decoded.PayloadHeader.AuxiliaryLength)
+	}
+
+	msg.PayloadHeader.AuxiliaryLength = 0
+	msg.SyncAuxiliaryHeader()
+	assert.Equal(t, dtx.AuxiliaryHeader{}, msg.AuxiliaryHeader)
+}
+
+func TestEncodedSize(t *testing.T) {
+	nested := dtx.DtxPrimitiveDictionary{}
+	nested.AddNull()
+	aux := dtx.DtxPrimitiveDictionary{}
+	aux.AddInt32(1)
+	aux.AddBytes([]byte{1, 2, 3})
+	aux.AddDictionary(nested)
+	msgs := []dtx.DtxMessage{
+		{},
+		{Auxiliary: dtx.NewPrimitiveDictionary()},
+		{Auxiliary: aux},
+		{Auxiliary: aux, Payload: []interface{}{map[string]interface{}{"a": []interface{}{"b", 1}}}},
+		decodeFixture("fixtures/notifyOfPublishedCapabilites"),
+		decodeFixture("fixtures/requestChannelWithCode"),
+	}
+	for _, msg := range msgs {
+		frame, err := dtx.Encode(msg)
+		assert.NoError(t, err)
+		size, err := dtx.EncodedSize(msg)
+		assert.NoError(t, err)
+		assert.Equal(t, len(frame), size)
+	}
+}
+
+func TestVerifyEncode(t *testing.T) {
+	aux := dtx.DtxPrimitiveDictionary{}
+	aux.AddInt32(1)
+	msg := dtx.DtxMessage{Identifier: 4, ChannelCode: 2, ExpectsReply: true, Auxiliary: aux, Payload: []interface{}{"selector:"},
+		PayloadHeader: dtx.DtxPayloadHeader{MessageType: dtx.MethodInvocationWithExpectedReply}}
+	assert.NoError(t, dtx.VerifyEncode(msg))
+	assert.NoError(t, dtx.VerifyEncode(decodeFixture("fixtures/notifyOfPublishedCapabilites")))
+	//ints come back as uint64 from the unarchiver
+	integers := dtx.DtxMessage{Payload: []interface{}{map[string]interface{}{"ur": 1000, "pids": []interface{}{1, int64(2)}}, 42}}
+	assert.NoError(t, dtx.VerifyEncode(integers))
+	other := integers
+	other.Payload = []interface{}{integers.Payload[0], uint64(43)}
+	assert.Equal(t, 1, len(dtx.Diff(integers, other)))
+
+	msg.Fragments = 3
+	msg.FragmentIndex = 1
+	err := dtx.VerifyEncode(msg)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Fragments")
+	}
+}
+
+func TestEncodeRawAuxiliary(t *testing.T) {
+	aux := dtx.NewPrimitiveDictionary()
+	aux.AddInt32(7)
+	msg := dtx.DtxMessage{Identifier: 4, ChannelCode: 2, Auxiliary: aux, Payload: []interface{}{"forward:"},
+		PayloadHeader: dtx.DtxPayloadHeader{MessageType: dtx.MethodinvocationWithoutExpectedReply}}
+	original, err := dtx.Encode(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	//a BufferSize Encode would not produce by itself
+	binary.LittleEndian.PutUint32(original[48:], 1024)
+
+	decoded, _, err := dtx.Decode(original)
+	if !assert.NoError(t, err) {
+		return
+	}
+	reencoded, err := dtx.Encode(decoded)
+	assert.NoError(t, err)
+	assert.NotEqual(t, original, reencoded)
+
+	decoded.SetRawAuxiliary(original[48 : 48+decoded.PayloadHeader.AuxiliaryLength])
+	forwarded, err := dtx.Encode(decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, original, forwarded)
+	size, err := dtx.EncodedSize(decoded)
+	assert.NoError(t, err)
+	assert.Equal(t, len(original), size)
+}
+
+func TestEncodeRejectsInconsistentFragments(t *testing.T) {
+	for _, msg := range []dtx.DtxMessage{
+		{Fragments: 1, FragmentIndex: 1},
+		{Fragments: 0, FragmentIndex: 1},
+		{Fragments: 2, FragmentIndex: 2},
+		{Fragments: 3, FragmentIndex: 1},
+		{Fragments: 3, FragmentIndex: 0},
+	} {
+		assert.Error(t, msg.Validate(), "%d of %d", msg.FragmentIndex, msg.Fragments)
+		_, err := dtx.Encode(msg)
+		assert.Error(t, err, "%d of %d", msg.FragmentIndex, msg.Fragments)
+	}
+	assert.NoError(t, dtx.DtxMessage{Fragments: 1}.Validate())
+	assert.NoError(t, dtx.DtxMessage{}.Validate())
+
+	fragments, err := dtx.EncodeFragmented(dtx.DtxMessage{Fragments: 3, FragmentIndex: 1, Payload: []interface{}{"selector:"}}, 1000)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, len(fragments))
+	}
+}
+
+func TestReconstructStream(t *testing.T) {
+	var capture []byte
+	for _, name := range []string{"fixtures/notifyOfPublishedCapabilites", "fixtures/requestChannelWithCode"} {
+		dat, err := ioutil.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		capture = append(capture, dat...)
+		for _, fragment := range fragmentFrame(dat, 3) {
+			capture = append(capture, fragment...)
+		}
+	}
+	capture = append(capture, dtx.GenerateAckStream(1, 1)[0]...)
+
+	msgs, err := dtx.DecodeAll(capture)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 11, len(msgs))
+	stream, err := dtx.ReconstructStream(msgs)
+	if assert.NoError(t, err) {
+		assert.Equal(t, capture, stream)
+	}
+
+	built := append(msgs, dtx.NewKeepAlive(2))
+	stream, err = dtx.ReconstructStream(built)
+	if assert.NoError(t, err) {
+		keepAlive, err := dtx.Encode(dtx.NewKeepAlive(2))
+		assert.NoError(t, err)
+		assert.Equal(t, append(capture, keepAlive...), stream)
+	}
+}
+
+//failingWriter accepts limit bytes and fails afterwards
+type failingWriter struct {
+	limit int
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if len(b) > w.limit {
+		n := w.limit
+		w.limit = 0
+		return n, errors.New("connection reset")
+	}
+	w.limit -= len(b)
+	return len(b), nil
+}
+
+func TestWriteTo(t *testing.T) {
+	msg := decodeFixture("fixtures/requestChannelWithCode")
+	frame, err := dtx.Encode(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var _ io.WriterTo = msg
+	var w trickleWriter
+	n, err := msg.WriteTo(&w)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(frame)), n)
+	assert.Equal(t, frame, w.Bytes())
+
+	n, err = msg.WriteTo(&failingWriter{limit: 40})
+	assert.Error(t, err)
+	assert.Equal(t, int64(40), n)
+
+	var buf bytes.Buffer
+	n, err = msg.WriteFragmentedTo(&buf, 100)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int64(buf.Len()), n)
+	decoder := dtx.NewDecoder(&buf)
+	var assembler dtx.FragmentAssembler
+	for {
+		fragment, err := decoder.Decode()
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.True(t, fragment.IsFragment())
+		result, done, err := assembler.Add(fragment)
+		assert.NoError(t, err)
+		if done {
+			assert.True(t, msg.Equal(result))
+			break
+		}
+	}
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+}
@@ -0,0 +1,131 @@
+package dtx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+)
+
+//FragmentAssembler stitches fragmented messages back together. Fragments of different messages may be
+//interleaved, they are kept apart by Identifier. The zero value is ready to use.
+type FragmentAssembler struct {
+	//Options are applied when decoding an assembled message. The framing options do not apply, the fragments
+	//are put together into a standard frame.
+	Options DecodeOptions
+	pending map[int]*pendingMessage
+	//completed holds the fragment checksums of the last completedHistory messages to recognize late retransmits
+	completed      map[int]map[uint16]uint32
+	completedOrder []int
+}
+
+//completedHistory is the number of completed messages whose retransmitted fragments are recognized and ignored
+const completedHistory = 16
+
+type pendingMessage struct {
+	first DtxMessage
+	//fragments holds the header of the first fragment and the bytes of all following ones by FragmentIndex
+	fragments map[uint16][]byte
+}
+
+//Add feeds a decoded frame to the assembler. Messages that are not fragmented are returned right away.
+//Once all fragments of a message were added, the fragment bytes are concatenated and decoded, the auxiliary
+//and payload of the returned message are fully parsed and done is true. If only the payload of the assembled
+//message cannot be decoded, the partial message is returned with done set and a PayloadError.
+//The fragments of a message have to be added in order and have to agree on the number of Fragments, otherwise
+//Add fails and the message is dropped, its remaining fragments fail as well until its first fragment is added again.
+//Devices on unreliable links retransmit fragments, a fragment that exactly repeats one already added is ignored,
+//also if its message was completed recently. A fragment with the same Identifier and FragmentIndex but different
+//bytes is an error.
+func (a *FragmentAssembler) Add(msg DtxMessage) (complete DtxMessage, done bool, err error) {
+	if !msg.IsFragment() {
+		return msg, true, nil
+	}
+	if a.pending == nil {
+		a.pending = map[int]*pendingMessage{}
+	}
+	fragment := msg.fragmentBytes
+	if msg.IsFirstFragment() {
+		//the first fragment only consists of the header which describes the whole message
+		fragment = appendRoutingHeader(nil, msg, msg.FragmentIndex, msg.Fragments, msg.MessageLength)
+	}
+	pending, ok := a.pending[msg.Identifier]
+	if !ok {
+		if checksums, ok := a.completed[msg.Identifier]; ok {
+			if checksum, ok := checksums[msg.FragmentIndex]; ok && checksum == crc32.ChecksumIEEE(fragment) {
+				return DtxMessage{}, false, nil
+			}
+			if !msg.IsFirstFragment() {
+				return DtxMessage{}, false, fmt.Errorf("Fragment %d of message %d was received twice with different bytes", msg.FragmentIndex, msg.Identifier)
+			}
+		}
+		if !msg.IsFirstFragment() {
+			return DtxMessage{}, false, fmt.Errorf("Fragment %d of message %d arrived before the first fragment", msg.FragmentIndex, msg.Identifier)
+		}
+		pending = &pendingMessage{first: msg, fragments: map[uint16][]byte{}}
+		a.pending[msg.Identifier] = pending
+	}
+	if msg.Fragments != pending.first.Fragments {
+		delete(a.pending, msg.Identifier)
+		return DtxMessage{}, false, fmt.Errorf("Fragment %d of message %d claims %d fragments but the first fragment announced %d",
+			msg.FragmentIndex, msg.Identifier, msg.Fragments, pending.first.Fragments)
+	}
+	if previous, ok := pending.fragments[msg.FragmentIndex]; ok {
+		if !bytes.Equal(previous, fragment) {
+			delete(a.pending, msg.Identifier)
+			return DtxMessage{}, false, fmt.Errorf("Fragment %d of message %d was received twice with different bytes", msg.FragmentIndex, msg.Identifier)
+		}
+		return DtxMessage{}, false, nil
+	}
+	if expected := uint16(len(pending.fragments)); msg.FragmentIndex != expected {
+		delete(a.pending, msg.Identifier)
+		return DtxMessage{}, false, fmt.Errorf("Fragment %d of message %d arrived out of order, expected fragment %d", msg.FragmentIndex, msg.Identifier, expected)
+	}
+	pending.fragments[msg.FragmentIndex] = append([]byte{}, fragment...)
+	if len(pending.fragments) < int(msg.Fragments) {
+		return DtxMessage{}, false, nil
+	}
+	delete(a.pending, msg.Identifier)
+	a.remember(msg.Identifier, pending)
+	return pending.assemble(a.Options)
+}
+
+//remember stores the fragment checksums of a completed message, forgetting the oldest one beyond completedHistory
+func (a *FragmentAssembler) remember(identifier int, p *pendingMessage) {
+	if a.completed == nil {
+		a.completed = map[int]map[uint16]uint32{}
+	}
+	if _, ok := a.completed[identifier]; !ok {
+		a.completedOrder = append(a.completedOrder, identifier)
+	}
+	checksums := make(map[uint16]uint32, len(p.fragments))
+	for index, fragment := range p.fragments {
+		checksums[index] = crc32.ChecksumIEEE(fragment)
+	}
+	a.completed[identifier] = checksums
+	if len(a.completedOrder) > completedHistory {
+		delete(a.completed, a.completedOrder[0])
+		a.completedOrder = a.completedOrder[1:]
+	}
+}
+
+func (p *pendingMessage) assemble(options DecodeOptions) (DtxMessage, bool, error) {
+	var body []byte
+	for i := uint16(1); i < p.first.Fragments; i++ {
+		body = append(body, p.fragments[i]...)
+	}
+	if len(body) != p.first.MessageLength {
+		return DtxMessage{}, false, fmt.Errorf("Fragments of message %d add up to %d bytes, the first fragment announced %d",
+			p.first.Identifier, len(body), p.first.MessageLength)
+	}
+	frame := appendRoutingHeader(nil, p.first, 0, 1, len(body))
+	options.AllowLittleEndianMagic = false
+	options.TrailingCRC = false
+	options.MessageLengthIncludesHeader = false
+	msg, _, err := decodeFrame(append(frame, body...), options)
+	var payloadError *PayloadError
+	if err != nil && !errors.As(err, &payloadError) {
+		return DtxMessage{}, false, err
+	}
+	return msg, true, err
+}
@@ -0,0 +1,235 @@
+package dtx_test
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func decodeFragments(frames [][]byte) []dtx.DtxMessage {
+	result := make([]dtx.DtxMessage, len(frames))
+	for i, frame := range frames {
+		msg, _, err := dtx.Decode(frame)
+		if err != nil {
+			log.Fatal(err)
+		}
+		result[i] = msg
+	}
+	return result
+}
+
+func TestFragmentAssemblerDuplicates(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fragments := decodeFragments(fragmentFrame(dat, 2))
+
+	assembler := dtx.FragmentAssembler{}
+	for i, fragment := range []dtx.DtxMessage{fragments[0], fragments[1], fragments[1], fragments[0]} {
+		_, done, err := assembler.Add(fragment)
+		assert.NoError(t, err, "fragment %d", i)
+		assert.False(t, done)
+	}
+	msg, done, err := assembler.Add(fragments[2])
+	if assert.NoError(t, err) && assert.True(t, done) {
+		expected := decodeFixture("fixtures/requestChannelWithCode")
+		assert.Equal(t, expected.Payload, msg.Payload)
+		assert.Equal(t, expected.Auxiliary.String(), msg.Auxiliary.String())
+	}
+
+	//retransmits arriving after the message was completed are ignored as well
+	for i, fragment := range fragments {
+		_, done, err := assembler.Add(fragment)
+		assert.NoError(t, err, "fragment %d", i)
+		assert.False(t, done)
+	}
+	changed := fragmentFrame(dat, 2)
+	changed[2][len(changed[2])-1]++
+	_, _, err = assembler.Add(decodeFragments(changed)[2])
+	assert.Error(t, err)
+
+	assembler = dtx.FragmentAssembler{}
+	frames := fragmentFrame(dat, 2)
+	_, _, err = assembler.Add(fragments[0])
+	assert.NoError(t, err)
+	_, _, err = assembler.Add(fragments[1])
+	assert.NoError(t, err)
+	frames[1][len(frames[1])-1]++
+	_, done, err = assembler.Add(decodeFragments(frames)[1])
+	assert.Error(t, err)
+	assert.False(t, done)
+}
+
+func TestFragmentAssemblerPassesThroughWholeMessages(t *testing.T) {
+	msg := decodeFixture("fixtures/notifyOfPublishedCapabilites")
+	assembler := dtx.FragmentAssembler{}
+	result, done, err := assembler.Add(msg)
+	if assert.NoError(t, err) && assert.True(t, done) {
+		assert.Equal(t, msg.Payload, result.Payload)
+	}
+}
+
+func TestIsFirstFragmentFor(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fragments := decodeFragments(fragmentFrame(dat, 2))
+
+	isFirst, err := fragments[0].IsFirstFragmentFor(fragments[1])
+	assert.NoError(t, err)
+	assert.True(t, isFirst)
+	isFirst, err = fragments[0].IsFirstFragmentFor(decodeFixture("fixtures/notifyOfPublishedCapabilites"))
+	assert.NoError(t, err)
+	assert.False(t, isFirst)
+
+	assert.NotPanics(t, func() {
+		_, err = fragments[1].IsFirstFragmentFor(fragments[2])
+	})
+	assert.Error(t, err)
+
+	assert.True(t, fragments[0].MessageIsFirstFragmentFor(fragments[1]))
+	assert.Panics(t, func() { fragments[1].MessageIsFirstFragmentFor(fragments[2]) })
+}
+
+func TestFragmentAssembler(t *testing.T) {
+	first, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	second, err := ioutil.ReadFile("fixtures/notifyOfPublishedCapabilites")
+	if err != nil {
+		log.Fatal(err)
+	}
+	a := decodeFragments(fragmentFrame(first, 3))
+	b := decodeFragments(fragmentFrame(second, 2))
+
+	assembler := dtx.FragmentAssembler{}
+	var completed []dtx.DtxMessage
+	for _, fragment := range []dtx.DtxMessage{a[0], b[0], a[1], b[1], a[2], b[2], a[3]} {
+		msg, done, err := assembler.Add(fragment)
+		if !assert.NoError(t, err) {
+			return
+		}
+		if done {
+			completed = append(completed, msg)
+		}
+	}
+	if assert.Equal(t, 2, len(completed)) {
+		assert.Empty(t, dtx.Diff(decodeFixture("fixtures/notifyOfPublishedCapabilites"), completed[0]))
+		assert.Empty(t, dtx.Diff(decodeFixture("fixtures/requestChannelWithCode"), completed[1]))
+		assert.True(t, completed[1].HasAuxiliary())
+	}
+
+	assembler = dtx.FragmentAssembler{}
+	_, _, err = assembler.Add(a[1])
+	assert.Error(t, err, "fragment before the first one")
+	_, _, err = assembler.Add(a[0])
+	assert.NoError(t, err)
+	_, _, err = assembler.Add(a[2])
+	assert.Error(t, err, "fragment 2 before fragment 1")
+	_, _, err = assembler.Add(a[1])
+	assert.Error(t, err, "the failed message was dropped")
+
+	_, _, err = assembler.Add(a[0])
+	assert.NoError(t, err)
+	mismatched := decodeFragments(fragmentFrame(first, 2))
+	_, _, err = assembler.Add(mismatched[1])
+	assert.Error(t, err, "different fragment count")
+
+	_, _, err = assembler.Add(a[0])
+	assert.NoError(t, err)
+	for _, fragment := range a[1:3] {
+		_, _, err = assembler.Add(fragment)
+		assert.NoError(t, err)
+	}
+	msg, done, err := assembler.Add(a[3])
+	if assert.NoError(t, err) && assert.True(t, done) {
+		assert.Equal(t, "_requestChannelWithCode:identifier:", msg.Payload[0])
+	}
+}
+
+func TestEncodeFragmented(t *testing.T) {
+	msg := decodeFixture("fixtures/notifyOfPublishedCapabilites")
+	frame, err := dtx.Encode(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	bodyLength := len(frame) - 32
+	for _, size := range []int{100, bodyLength / 4, bodyLength - 1} {
+		frames, err := dtx.EncodeFragmented(msg, size)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		parts := (bodyLength + size - 1) / size
+		assert.Equal(t, parts+1, len(frames), "fragment size %d", size)
+		fragments := decodeFragments(frames)
+		assert.True(t, fragments[0].IsFirstFragment())
+		assert.Equal(t, bodyLength, fragments[0].MessageLength)
+		var assembler dtx.FragmentAssembler
+		for i, fragment := range fragments {
+			assert.Equal(t, uint16(parts+1), fragment.Fragments)
+			assert.Equal(t, uint16(i), fragment.FragmentIndex)
+			if i > 0 {
+				assert.True(t, fragment.MessageLength <= size)
+				assert.Equal(t, fragment.MessageLength+32, len(frames[i]))
+			}
+			result, done, err := assembler.Add(fragment)
+			assert.NoError(t, err)
+			assert.Equal(t, i == parts, done)
+			if done {
+				assert.Empty(t, dtx.Diff(msg, result))
+				assert.Equal(t, msg.Payload, result.Payload)
+			}
+		}
+	}
+
+	//a body that divides evenly must not produce an empty trailing fragment
+	if assert.Equal(t, 0, bodyLength%4) {
+		frames, err := dtx.EncodeFragmented(msg, bodyLength/4)
+		if assert.NoError(t, err) && assert.Equal(t, 5, len(frames)) {
+			last := decodeFragments(frames)[4]
+			assert.Equal(t, bodyLength/4, last.MessageLength)
+			assert.True(t, last.IsLastFragment())
+		}
+	}
+
+	frames, err := dtx.EncodeFragmented(msg, bodyLength)
+	if assert.NoError(t, err) && assert.Equal(t, 1, len(frames)) {
+		assert.Equal(t, frame, frames[0])
+	}
+	_, err = dtx.EncodeFragmented(msg, 0)
+	assert.Error(t, err)
+	_, err = dtx.EncodeFragmented(msg, 1)
+	assert.NoError(t, err)
+}
+
+func TestDecodeInvalidFragmentIndex(t *testing.T) {
+	frame := buildFrame(1, 1, nil, nil)
+	for _, header := range [][2]uint16{{2, 5}, {2, 2}, {0, 1}, {0, 65535}} {
+		binary.LittleEndian.PutUint16(frame[10:], header[0])
+		binary.LittleEndian.PutUint16(frame[8:], header[1])
+		_, _, err := dtx.Decode(frame)
+		assert.True(t, errors.Is(err, dtx.ErrInvalidFragmentIndex), "%v: %v", header, err)
+
+		var headerBytes [32]byte
+		copy(headerBytes[:], frame)
+		_, err = dtx.ParseHeaderArray(&headerBytes)
+		assert.True(t, errors.Is(err, dtx.ErrInvalidFragmentIndex), "%v: %v", header, err)
+
+		msg := dtx.DtxMessage{Fragments: header[0], FragmentIndex: header[1]}
+		assert.False(t, msg.IsLastFragment(), "%v", header)
+	}
+
+	binary.LittleEndian.PutUint16(frame[10:], 0)
+	binary.LittleEndian.PutUint16(frame[8:], 0)
+	_, _, err := dtx.Decode(frame)
+	assert.NoError(t, err)
+	assert.True(t, dtx.DtxMessage{Fragments: 2, FragmentIndex: 1}.IsLastFragment())
+}
@@ -0,0 +1,39 @@
+//go:build go1.18
+// +build go1.18
+
+package dtx_test
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+)
+
+func FuzzDecode(f *testing.F) {
+	for _, fixture := range []string{"fixtures/notifyOfPublishedCapabilites", "fixtures/requestChannelWithCode"} {
+		dat, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			log.Fatal(err)
+		}
+		f.Add(dat)
+		for _, fragment := range fragmentFrame(dat, 2) {
+			f.Add(fragment)
+		}
+	}
+	f.Add(dtx.GenerateAckStream(1, 1)[0])
+	f.Fuzz(func(t *testing.T, b []byte) {
+		msg, remainingBytes, err := dtx.Decode(b)
+		if err != nil {
+			return
+		}
+		if len(remainingBytes) > len(b) {
+			t.Fatalf("Decode returned %d remaining bytes for an input of %d", len(remainingBytes), len(b))
+		}
+		//exercise the accessors that work on the raw bytes of a decoded message
+		_ = msg.String()
+		msg.AuxiliaryCount()
+		_ = msg.PayloadFormat()
+	})
+}
@@ -0,0 +1,39 @@
+package dtx
+
+import (
+	"fmt"
+	"strings"
+)
+
+//GoLiteral renders the message as Go source that can be pasted into a test as a fixture.
+//The unexported fields of DtxMessage cannot be set from outside the package, so the result is an
+//anonymous struct holding the header fields and the raw frame bytes. Run RawBytes through Decode
+//to get the fully populated message back.
+func (d DtxMessage) GoLiteral() string {
+	var b strings.Builder
+	b.WriteString("struct {\n\tMessage  dtx.DtxMessage\n\tRawBytes []byte\n}{\n")
+	b.WriteString("\tMessage: dtx.DtxMessage{\n")
+	fmt.Fprintf(&b, "\t\tFragments:         %d,\n", d.Fragments)
+	fmt.Fprintf(&b, "\t\tFragmentIndex:     %d,\n", d.FragmentIndex)
+	fmt.Fprintf(&b, "\t\tMessageLength:     %d,\n", d.MessageLength)
+	fmt.Fprintf(&b, "\t\tIdentifier:        %d,\n", d.Identifier)
+	fmt.Fprintf(&b, "\t\tConversationIndex: %d,\n", d.ConversationIndex)
+	fmt.Fprintf(&b, "\t\tChannelCode:       %d,\n", d.ChannelCode)
+	fmt.Fprintf(&b, "\t\tExpectsReply:      %t,\n", d.ExpectsReply)
+	fmt.Fprintf(&b, "\t\tPayloadHeader: dtx.DtxPayloadHeader{MessageType: %d, AuxiliaryLength: %d, TotalPayloadLength: %d, Flags: %d},\n",
+		d.PayloadHeader.MessageType, d.PayloadHeader.AuxiliaryLength, d.PayloadHeader.TotalPayloadLength, d.PayloadHeader.Flags)
+	fmt.Fprintf(&b, "\t\tAuxiliaryHeader: dtx.AuxiliaryHeader{BufferSize: %d, Unknown: %d, AuxiliarySize: %d, Unknown2: %d},\n",
+		d.AuxiliaryHeader.BufferSize, d.AuxiliaryHeader.Unknown, d.AuxiliaryHeader.AuxiliarySize, d.AuxiliaryHeader.Unknown2)
+	b.WriteString("\t},\n")
+	b.WriteString("\tRawBytes: []byte{")
+	for i, v := range d.rawBytes {
+		if i%16 == 0 {
+			b.WriteString("\n\t\t")
+		} else {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "0x%02x,", v)
+	}
+	b.WriteString("\n\t},\n}")
+	return b.String()
+}
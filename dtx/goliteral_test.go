@@ -0,0 +1,49 @@
+package dtx_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoLiteral(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	msg, _, err := dtx.Decode(dat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	expr, err := parser.ParseExpr(msg.GoLiteral())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var rawBytes []byte
+	for _, elt := range expr.(*ast.CompositeLit).Elts {
+		kv := elt.(*ast.KeyValueExpr)
+		if kv.Key.(*ast.Ident).Name != "RawBytes" {
+			continue
+		}
+		for _, b := range kv.Value.(*ast.CompositeLit).Elts {
+			lit := b.(*ast.BasicLit)
+			assert.Equal(t, token.INT, lit.Kind)
+			v, err := strconv.ParseUint(lit.Value, 0, 8)
+			assert.NoError(t, err)
+			rawBytes = append(rawBytes, byte(v))
+		}
+	}
+	decoded, _, err := dtx.Decode(rawBytes)
+	if assert.NoError(t, err) {
+		assert.Equal(t, msg.String(), decoded.String())
+		assert.Equal(t, msg.Payload, decoded.Payload)
+	}
+}
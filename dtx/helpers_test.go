@@ -0,0 +1,93 @@
+package dtx_test
+
+import (
+	"encoding/binary"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"howett.net/plist"
+)
+
+//buildFrame assembles a non fragmented method invocation frame around raw auxiliary and payload bytes.
+//auxiliary must be an encoded primitive dictionary without the auxiliary header, it is prepended here.
+func buildFrame(identifier int, channel int, auxiliary []byte, payload []byte) []byte {
+	auxLength := 0
+	if len(auxiliary) > 0 {
+		auxLength = 16 + len(auxiliary)
+	}
+	frame := make([]byte, 48+auxLength+len(payload))
+	binary.BigEndian.PutUint32(frame, dtx.DtxMessageMagic)
+	binary.LittleEndian.PutUint32(frame[4:], dtx.DtxHeaderLength)
+	binary.LittleEndian.PutUint16(frame[8:], 0)
+	binary.LittleEndian.PutUint16(frame[10:], 1)
+	binary.LittleEndian.PutUint32(frame[12:], uint32(len(frame)-32))
+	binary.LittleEndian.PutUint32(frame[16:], uint32(identifier))
+	binary.LittleEndian.PutUint32(frame[24:], uint32(channel))
+
+	binary.LittleEndian.PutUint32(frame[32:], dtx.MethodinvocationWithoutExpectedReply)
+	binary.LittleEndian.PutUint32(frame[36:], uint32(auxLength))
+	binary.LittleEndian.PutUint32(frame[40:], uint32(auxLength+len(payload)))
+	if auxLength > 0 {
+		binary.LittleEndian.PutUint32(frame[48:], uint32(auxLength+len(payload)))
+		binary.LittleEndian.PutUint32(frame[56:], uint32(len(auxiliary)))
+		copy(frame[64:], auxiliary)
+	}
+	copy(frame[48+auxLength:], payload)
+	return frame
+}
+
+//archiveObject builds a binary NSKeyedArchiver archive whose root is an object of the given class
+func archiveObject(className string, fields map[string]interface{}) []byte {
+	root := map[string]interface{}{"$class": plist.UID(2)}
+	for k, v := range fields {
+		root[k] = v
+	}
+	archive := map[string]interface{}{
+		"$version":  100000,
+		"$archiver": "NSKeyedArchiver",
+		"$top":      map[string]interface{}{"root": plist.UID(1)},
+		"$objects": []interface{}{
+			"$null",
+			root,
+			map[string]interface{}{"$classname": className, "$classes": []interface{}{className, "NSObject"}},
+		},
+	}
+	b, err := plist.Marshal(archive, plist.BinaryFormat)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+//fragmentFrame splits an encoded, non fragmented frame into a header only first fragment followed by
+//parts fragments carrying the bytes after the routing header.
+func fragmentFrame(frame []byte, parts int) [][]byte {
+	body := frame[32:]
+	fragments := uint16(parts + 1)
+	header := func(index uint16, length int) []byte {
+		h := append([]byte{}, frame[:32]...)
+		binary.LittleEndian.PutUint16(h[8:], index)
+		binary.LittleEndian.PutUint16(h[10:], fragments)
+		binary.LittleEndian.PutUint32(h[12:], uint32(length))
+		return h
+	}
+	result := [][]byte{header(0, len(body))}
+	size := (len(body) + parts - 1) / parts
+	for i := 0; i < parts; i++ {
+		end := (i + 1) * size
+		if end > len(body) {
+			end = len(body)
+		}
+		part := body[i*size : end]
+		result = append(result, append(header(uint16(i+1), len(part)), part...))
+	}
+	return result
+}
+
+//archiveValue returns the keyed archive Encode produces for a payload consisting of value
+func archiveValue(value interface{}) []byte {
+	frame, err := dtx.Encode(dtx.DtxMessage{Payload: []interface{}{value}})
+	if err != nil {
+		panic(err)
+	}
+	return frame[48:]
+}
@@ -0,0 +1,109 @@
+package dtx
+
+//IncrementalDecoder decodes a frame while its bytes arrive. The routing header is available as
+//soon as the first 32 bytes were fed and the auxiliary as soon as AuxiliaryLength more bytes after the
+//payload header arrived, which allows routing a message before its payload arrived. The zero value decodes
+//standard frames, use NewIncrementalDecoder for other DecodeOptions.
+type IncrementalDecoder struct {
+	options        DecodeOptions
+	buffer         []byte
+	header         *DtxMessage
+	auxiliaryReady bool
+	err            error
+}
+
+//NewIncrementalDecoder creates an IncrementalDecoder that applies options to every frame.
+func NewIncrementalDecoder(options DecodeOptions) *IncrementalDecoder {
+	return &IncrementalDecoder{options: options}
+}
+
+//Feed appends b to the internal buffer. headerReady is true once the header of the current frame
+//was parsed, msg then points to a message with only the routing header populated. Once the auxiliary
+//arrived, the payload header and Auxiliary of msg are filled in as well, see AuxiliaryReady. Once the frame is
+//complete, msg points to the fully decoded message and complete is true. Bytes after the frame are kept
+//for the next one, call Feed(nil) to continue with them. If the frame cannot be decoded Feed returns
+//nothing from then on and Err reports the problem.
+func (p *IncrementalDecoder) Feed(b []byte) (headerReady bool, msg *DtxMessage, complete bool) {
+	if p.err != nil {
+		return false, nil, false
+	}
+	p.buffer = append(p.buffer, b...)
+	if p.header == nil {
+		if len(p.buffer) < int(DtxHeaderLength) {
+			return false, nil, false
+		}
+		var headerBytes [32]byte
+		copy(headerBytes[:], p.buffer)
+		header, err := parseHeaderArray(&headerBytes, p.options)
+		if err != nil {
+			p.err = err
+			return false, nil, false
+		}
+		p.header = &header
+		p.auxiliaryReady = false
+	}
+	frameLength := p.options.wireLength(*p.header)
+	if len(p.buffer) < frameLength {
+		if !p.auxiliaryReady {
+			p.auxiliaryReady = p.decodeAuxiliary()
+		}
+		return true, p.header, false
+	}
+	result, _, err := DecodeWithOptions(p.buffer[:frameLength], p.options)
+	if err != nil {
+		p.err = err
+		return false, nil, false
+	}
+	p.buffer = append([]byte{}, p.buffer[frameLength:]...)
+	p.header = nil
+	p.auxiliaryReady = true
+	return true, &result, true
+}
+
+//AuxiliaryReady tells if the PayloadHeader, AuxiliaryHeader and Auxiliary of the message last returned by Feed
+//are decoded. Fragments never have an auxiliary of their own, for them it becomes true with the complete frame.
+func (p *IncrementalDecoder) AuxiliaryReady() bool {
+	return p.auxiliaryReady
+}
+
+//decodeAuxiliary fills in the payload header and auxiliary of the current header once their bytes are buffered.
+//Inconsistent lengths are left for the final decode of the frame to report.
+func (p *IncrementalDecoder) decodeAuxiliary() bool {
+	if p.header.IsFragment() || len(p.buffer) < 48 {
+		return false
+	}
+	ph, err := parsePayloadHeader(p.buffer[32:48])
+	if err != nil {
+		return false
+	}
+	payloadSpace := p.options.frameLength(p.header.MessageLength) - 48
+	if ph.AuxiliaryLength < 0 || ph.AuxiliaryLength > ph.TotalPayloadLength || ph.TotalPayloadLength > payloadSpace {
+		return false
+	}
+	end := 48 + ph.AuxiliaryLength
+	if len(p.buffer) < end {
+		return false
+	}
+	header := *p.header
+	header.PayloadHeader = ph
+	if header.HasAuxiliary() {
+		if ph.AuxiliaryLength < 16 {
+			return false
+		}
+		auxiliaryHeader, err := parseAuxiliaryHeader(p.buffer[48:64])
+		if err != nil {
+			return false
+		}
+		header.AuxiliaryHeader = auxiliaryHeader
+		if err := decodeAuxiliaryInto(p.buffer[64:end], p.options.KeepUnknownPrimitives, &header.Auxiliary); err != nil {
+			return false
+		}
+	}
+	*p.header = header
+	return true
+}
+
+//Err returns the error that stopped decoding, if any.
+func (p *IncrementalDecoder) Err() error {
+	return p.err
+}
@@ -0,0 +1,74 @@
+package dtx_test
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncrementalDecoder(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	decoder := dtx.IncrementalDecoder{}
+
+	headerReady, msg, complete := decoder.Feed(dat[:20])
+	assert.False(t, headerReady)
+	assert.Nil(t, msg)
+
+	headerReady, msg, complete = decoder.Feed(dat[20:100])
+	assert.True(t, headerReady)
+	assert.False(t, complete)
+	if assert.NotNil(t, msg) {
+		assert.Equal(t, 3, msg.Identifier)
+		assert.Nil(t, msg.Payload)
+	}
+	assert.False(t, decoder.AuxiliaryReady())
+
+	//the auxiliary ends at 48+AuxiliaryLength
+	headerReady, msg, complete = decoder.Feed(dat[100:320])
+	assert.True(t, headerReady)
+	assert.False(t, complete)
+	if assert.True(t, decoder.AuxiliaryReady()) && assert.NotNil(t, msg) {
+		code, err := msg.Auxiliary.GetInt32(0)
+		assert.NoError(t, err)
+		assert.Equal(t, int32(1), code)
+		assert.Nil(t, msg.Payload)
+	}
+
+	headerReady, msg, complete = decoder.Feed(dat[320:])
+	assert.True(t, headerReady)
+	assert.True(t, complete)
+	if assert.NotNil(t, msg) {
+		assert.Equal(t, "_requestChannelWithCode:identifier:", msg.Payload[0])
+	}
+	assert.NoError(t, decoder.Err())
+
+	headerReady, _, _ = decoder.Feed([]byte("not a dtx frame, but at least 32 bytes long"))
+	assert.False(t, headerReady)
+	assert.Error(t, decoder.Err())
+}
+
+func TestIncrementalDecoderOptions(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	checksum := make([]byte, 4)
+	binary.LittleEndian.PutUint32(checksum, crc32.ChecksumIEEE(dat))
+	withCRC := append(append([]byte{}, dat...), checksum...)
+
+	decoder := dtx.NewIncrementalDecoder(dtx.DecodeOptions{TrailingCRC: true})
+	_, _, complete := decoder.Feed(withCRC[:len(dat)])
+	assert.False(t, complete)
+	_, msg, complete := decoder.Feed(withCRC[len(dat):])
+	if assert.True(t, complete) && assert.NoError(t, decoder.Err()) {
+		assert.Equal(t, "_requestChannelWithCode:identifier:", msg.Payload[0])
+	}
+}
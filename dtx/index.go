@@ -0,0 +1,30 @@
+package dtx
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+//IndexRecordLength is the size of every record returned by IndexRecord
+const IndexRecordLength = 20
+
+//IndexRecord returns a fixed size summary of the message for building an index over captures.
+//The record is IndexRecordLength bytes of little endian uint32 values, this layout will not change:
+//  - 0:  Identifier
+//  - 4:  ConversationIndex
+//  - 8:  ChannelCode
+//  - 12: PayloadHeader.MessageType
+//  - 16: FNV-1a hash of the selector, 0 if the message is no method invocation
+func (d DtxMessage) IndexRecord() []byte {
+	record := make([]byte, IndexRecordLength)
+	binary.LittleEndian.PutUint32(record[0:], uint32(d.Identifier))
+	binary.LittleEndian.PutUint32(record[4:], uint32(d.ConversationIndex))
+	binary.LittleEndian.PutUint32(record[8:], uint32(d.ChannelCode))
+	binary.LittleEndian.PutUint32(record[12:], uint32(d.PayloadHeader.MessageType))
+	if selector, ok := d.selector(); ok && d.IsMethodInvocation() {
+		hash := fnv.New32a()
+		hash.Write([]byte(selector))
+		binary.LittleEndian.PutUint32(record[16:], hash.Sum32())
+	}
+	return record
+}
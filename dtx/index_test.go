@@ -0,0 +1,32 @@
+package dtx_test
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIndexRecord(t *testing.T) {
+	msg := decodeFixture("fixtures/requestChannelWithCode")
+	record := msg.IndexRecord()
+	assert.Equal(t, dtx.IndexRecordLength, len(record))
+	assert.Equal(t, uint32(msg.Identifier), binary.LittleEndian.Uint32(record[0:]))
+	assert.Equal(t, uint32(msg.ConversationIndex), binary.LittleEndian.Uint32(record[4:]))
+	assert.Equal(t, uint32(msg.ChannelCode), binary.LittleEndian.Uint32(record[8:]))
+	assert.Equal(t, uint32(msg.PayloadHeader.MessageType), binary.LittleEndian.Uint32(record[12:]))
+	hash := fnv.New32a()
+	hash.Write([]byte("_requestChannelWithCode:identifier:"))
+	assert.Equal(t, hash.Sum32(), binary.LittleEndian.Uint32(record[16:]))
+
+	ack := dtx.NewKeepAlive(3).IndexRecord()
+	assert.Equal(t, dtx.IndexRecordLength, len(ack))
+	assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(ack[8:]))
+	assert.Equal(t, uint32(0), binary.LittleEndian.Uint32(ack[16:]))
+
+	reply := dtx.DtxMessage{Identifier: 3, ConversationIndex: 1, PayloadHeader: dtx.DtxPayloadHeader{MessageType: 1},
+		Payload: []interface{}{"_requestChannelWithCode:identifier:"}}
+	assert.Equal(t, uint32(0), binary.LittleEndian.Uint32(reply.IndexRecord()[16:]))
+}
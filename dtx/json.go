@@ -0,0 +1,93 @@
+package dtx
+
+import "encoding/json"
+
+//jsonMessage is the schema MarshalJSON emits. Field names and order are part of the schema,
+//so captures written by different versions can be diffed.
+type jsonMessage struct {
+	Identifier        int                  `json:"identifier"`
+	ConversationIndex int                  `json:"conversationIndex"`
+	ChannelCode       int                  `json:"channelCode"`
+	ExpectsReply      bool                 `json:"expectsReply"`
+	Fragments         uint16               `json:"fragments"`
+	FragmentIndex     uint16               `json:"fragmentIndex"`
+	MessageLength     int                  `json:"messageLength"`
+	PayloadHeader     jsonPayloadHeader    `json:"payloadHeader"`
+	AuxiliaryHeader   jsonAuxiliaryHeader  `json:"auxiliaryHeader"`
+	Auxiliary         []jsonAuxiliaryEntry `json:"auxiliary"`
+	Payload           []interface{}        `json:"payload"`
+}
+
+type jsonPayloadHeader struct {
+	MessageType        int `json:"messageType"`
+	AuxiliaryLength    int `json:"auxiliaryLength"`
+	TotalPayloadLength int `json:"totalPayloadLength"`
+	Flags              int `json:"flags"`
+}
+
+type jsonAuxiliaryHeader struct {
+	BufferSize    uint32 `json:"bufferSize"`
+	Unknown       uint32 `json:"unknown"`
+	AuxiliarySize uint32 `json:"auxiliarySize"`
+	Unknown2      uint32 `json:"unknown2"`
+}
+
+//jsonAuxiliaryEntry holds one auxiliary argument. Archived objects are decoded into Value,
+//binary entries that are not an archive are emitted as base64 in Bytes instead.
+type jsonAuxiliaryEntry struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value,omitempty"`
+	Bytes []byte      `json:"bytes,omitempty"`
+}
+
+//MarshalJSON emits all routing fields, both headers, the decoded auxiliary entries and the full payload array,
+//so a session can be written to a structured log. Raw bytes are not part of the output.
+func (d DtxMessage) MarshalJSON() ([]byte, error) {
+	payload := d.Payload
+	if payload == nil {
+		payload = []interface{}{}
+	}
+	return json.Marshal(jsonMessage{
+		Identifier:        d.Identifier,
+		ConversationIndex: d.ConversationIndex,
+		ChannelCode:       d.ChannelCode,
+		ExpectsReply:      d.ExpectsReply,
+		Fragments:         d.Fragments,
+		FragmentIndex:     d.FragmentIndex,
+		MessageLength:     d.MessageLength,
+		PayloadHeader: jsonPayloadHeader{
+			MessageType:        d.PayloadHeader.MessageType,
+			AuxiliaryLength:    d.PayloadHeader.AuxiliaryLength,
+			TotalPayloadLength: d.PayloadHeader.TotalPayloadLength,
+			Flags:              d.PayloadHeader.Flags,
+		},
+		AuxiliaryHeader: jsonAuxiliaryHeader{
+			BufferSize:    d.AuxiliaryHeader.BufferSize,
+			Unknown:       d.AuxiliaryHeader.Unknown,
+			AuxiliarySize: d.AuxiliaryHeader.AuxiliarySize,
+			Unknown2:      d.AuxiliaryHeader.Unknown2,
+		},
+		Auxiliary: auxiliaryEntries(d.Auxiliary),
+		Payload:   payload,
+	})
+}
+
+func auxiliaryEntries(d DtxPrimitiveDictionary) []jsonAuxiliaryEntry {
+	result := make([]jsonAuxiliaryEntry, len(d.values))
+	for i, valueType := range d.valueTypes {
+		result[i].Type = toString(valueType)
+		switch valueType {
+		case bytearray:
+			if object, err := d.GetObject(i); err == nil {
+				result[i].Value = object
+			} else {
+				result[i].Bytes = d.values[i].([]byte)
+			}
+		case t_dictionary:
+			result[i].Value = auxiliaryEntries(d.values[i].(DtxPrimitiveDictionary))
+		default:
+			result[i].Value = d.values[i]
+		}
+	}
+	return result
+}
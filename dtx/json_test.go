@@ -0,0 +1,52 @@
+package dtx_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	msg := decodeFixture("fixtures/requestChannelWithCode")
+	b, err := json.Marshal(msg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var decoded map[string]interface{}
+	if !assert.NoError(t, json.Unmarshal(b, &decoded)) {
+		return
+	}
+	assert.Equal(t, float64(msg.Identifier), decoded["identifier"])
+	assert.Equal(t, float64(msg.ChannelCode), decoded["channelCode"])
+	assert.Equal(t, msg.ExpectsReply, decoded["expectsReply"])
+	assert.Equal(t, float64(msg.PayloadHeader.MessageType), decoded["payloadHeader"].(map[string]interface{})["messageType"])
+	assert.Equal(t, float64(msg.AuxiliaryHeader.BufferSize), decoded["auxiliaryHeader"].(map[string]interface{})["bufferSize"])
+	assert.Equal(t, []interface{}{"_requestChannelWithCode:identifier:"}, decoded["payload"])
+
+	aux := decoded["auxiliary"].([]interface{})
+	if assert.Equal(t, 2, len(aux)) {
+		assert.Equal(t, map[string]interface{}{"type": "uint32", "value": float64(1)}, aux[0])
+		assert.Equal(t, "binary", aux[1].(map[string]interface{})["type"])
+		assert.Equal(t, "dtxproxy:XCTestManager_IDEInterface:XCTestManager_DaemonConnectionInterface", aux[1].(map[string]interface{})["value"])
+	}
+
+	again, err := json.Marshal(msg)
+	assert.NoError(t, err)
+	assert.Equal(t, b, again)
+}
+
+func TestMarshalJSONAuxiliaryEntries(t *testing.T) {
+	nested := dtx.NewPrimitiveDictionary()
+	nested.AddInt64(3)
+	aux := dtx.NewPrimitiveDictionary()
+	aux.AddNull()
+	aux.AddBytes([]byte{1, 2})
+	aux.AddDictionary(nested)
+	b, err := json.Marshal(dtx.DtxMessage{Auxiliary: aux})
+	if assert.NoError(t, err) {
+		assert.Contains(t, string(b), `"auxiliary":[{"type":"null"},{"type":"binary","bytes":"AQI="},{"type":"dictionary","value":[{"type":"int64","value":3}]}]`)
+		assert.Contains(t, string(b), `"payload":[]`)
+	}
+}
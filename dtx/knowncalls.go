@@ -0,0 +1,121 @@
+package dtx
+
+import (
+	"fmt"
+	"sync"
+)
+
+//KnownCall is a method invocation with a recognized selector. Arguments holds the parsed arguments,
+//its type depends on the selector, for example *RequestChannelCall for "_requestChannelWithCode:identifier:".
+type KnownCall struct {
+	Selector  string
+	Arguments interface{}
+}
+
+//RequestChannelCall are the arguments of "_requestChannelWithCode:identifier:"
+type RequestChannelCall struct {
+	Code       int
+	Identifier string
+}
+
+//NotifyCapabilitiesCall are the arguments of "_notifyOfPublishedCapabilities:"
+type NotifyCapabilitiesCall struct {
+	Capabilities map[string]interface{}
+}
+
+//SetConfigCall are the arguments of "setConfig:", which instruments services like sysmontap receive before a trace starts
+type SetConfigCall struct {
+	Config map[string]interface{}
+}
+
+//KnownCallParser extracts the typed arguments of a method invocation with a specific selector.
+type KnownCallParser func(msg DtxMessage) (interface{}, error)
+
+var knownCallParsers = map[string]KnownCallParser{
+	"_requestChannelWithCode:identifier:": parseRequestChannelCall,
+	"_notifyOfPublishedCapabilities:":     parseNotifyCapabilitiesCall,
+	"setConfig:":                          parseSetConfigCall,
+}
+
+//knownCallMutex guards knownCallParsers, parsers may be registered while messages are parsed
+var knownCallMutex sync.RWMutex
+
+//RegisterKnownCall adds or replaces the parser ParseKnownCall uses for selector.
+func RegisterKnownCall(selector string, parser KnownCallParser) {
+	knownCallMutex.Lock()
+	defer knownCallMutex.Unlock()
+	knownCallParsers[selector] = parser
+}
+
+//ParseKnownCall returns the typed arguments for messages invoking a registered selector. It returns false
+//for all other messages and for messages whose arguments do not have the expected shape.
+func (d DtxMessage) ParseKnownCall() (KnownCall, bool) {
+	selector, ok := d.selector()
+	if !ok {
+		return KnownCall{}, false
+	}
+	knownCallMutex.RLock()
+	parser, ok := knownCallParsers[selector]
+	knownCallMutex.RUnlock()
+	if !ok {
+		return KnownCall{}, false
+	}
+	arguments, err := parser(d)
+	if err != nil {
+		return KnownCall{}, false
+	}
+	return KnownCall{Selector: selector, Arguments: arguments}, true
+}
+
+func parseRequestChannelCall(msg DtxMessage) (interface{}, error) {
+	code, err := msg.Auxiliary.GetInt32(0)
+	if err != nil {
+		return nil, err
+	}
+	identifier, err := msg.Auxiliary.unarchive(1)
+	if err != nil {
+		return nil, err
+	}
+	name, ok := identifier.(string)
+	if !ok {
+		return nil, fmt.Errorf("Channel identifier is not a string: %v", identifier)
+	}
+	return &RequestChannelCall{Code: int(code), Identifier: name}, nil
+}
+
+func parseNotifyCapabilitiesCall(msg DtxMessage) (interface{}, error) {
+	capabilities, err := msg.Auxiliary.unarchive(0)
+	if err != nil {
+		return nil, err
+	}
+	dictionary, ok := capabilities.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Capabilities are not a dictionary: %v", capabilities)
+	}
+	return &NotifyCapabilitiesCall{Capabilities: dictionary}, nil
+}
+
+func parseSetConfigCall(msg DtxMessage) (interface{}, error) {
+	config, err := msg.Auxiliary.unarchive(0)
+	if err != nil {
+		return nil, err
+	}
+	dictionary, ok := config.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Trace config is not a dictionary: %v", config)
+	}
+	return &SetConfigCall{Config: dictionary}, nil
+}
+
+//TraceConfig returns the configuration dictionary a "setConfig:" message sends to start a performance trace.
+//It fails for all other messages.
+func (d DtxMessage) TraceConfig() (map[string]interface{}, error) {
+	if selector, ok := d.selector(); !ok || selector != "setConfig:" {
+		return nil, fmt.Errorf("Message %s is no setConfig: call", d)
+	}
+	call, err := parseSetConfigCall(d)
+	if err != nil {
+		return nil, err
+	}
+	return call.(*SetConfigCall).Config, nil
+}
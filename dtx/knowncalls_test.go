@@ -0,0 +1,83 @@
+package dtx_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKnownCall(t *testing.T) {
+	call, ok := decodeFixture("fixtures/requestChannelWithCode").ParseKnownCall()
+	if assert.True(t, ok) {
+		assert.Equal(t, "_requestChannelWithCode:identifier:", call.Selector)
+		assert.Equal(t, &dtx.RequestChannelCall{Code: 1, Identifier: "dtxproxy:XCTestManager_IDEInterface:XCTestManager_DaemonConnectionInterface"}, call.Arguments)
+	}
+
+	call, ok = decodeFixture("fixtures/notifyOfPublishedCapabilites").ParseKnownCall()
+	if assert.True(t, ok) {
+		capabilities := call.Arguments.(*dtx.NotifyCapabilitiesCall).Capabilities
+		assert.Equal(t, uint64(1), capabilities["com.apple.private.DTXConnection"])
+	}
+
+	_, ok = dtx.DtxMessage{Payload: []interface{}{"_XCT_didBeginExecutingTestPlan"}}.ParseKnownCall()
+	assert.False(t, ok)
+}
+
+func TestTraceConfig(t *testing.T) {
+	config := map[string]interface{}{
+		"bm":             0,
+		"cpuUsage":       true,
+		"procAttrs":      []interface{}{"pid", "name", "cpuUsage"},
+		"sampleInterval": 1000000000,
+		"ur":             1000,
+	}
+	aux := dtx.NewPrimitiveDictionary()
+	aux.AddBytes(archiveValue(config))
+	frame, err := dtx.Encode(dtx.DtxMessage{Identifier: 6, ChannelCode: 1, ExpectsReply: true, Auxiliary: aux,
+		Payload: []interface{}{"setConfig:"}, PayloadHeader: dtx.DtxPayloadHeader{MessageType: dtx.MethodInvocationWithExpectedReply}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg, _, err := dtx.Decode(frame)
+	if !assert.NoError(t, err) {
+		return
+	}
+	decoded, err := msg.TraceConfig()
+	if assert.NoError(t, err) {
+		assert.Equal(t, true, decoded["cpuUsage"])
+		assert.Equal(t, uint64(1000), decoded["ur"])
+		assert.Equal(t, []interface{}{"pid", "name", "cpuUsage"}, decoded["procAttrs"])
+	}
+	call, ok := msg.ParseKnownCall()
+	if assert.True(t, ok) {
+		assert.Equal(t, decoded, call.Arguments.(*dtx.SetConfigCall).Config)
+	}
+
+	_, err = decodeFixture("fixtures/requestChannelWithCode").TraceConfig()
+	assert.Error(t, err)
+}
+
+func TestRegisterKnownCallConcurrently(t *testing.T) {
+	msg := dtx.DtxMessage{Payload: []interface{}{"_test_registeredCall"}}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			dtx.RegisterKnownCall("_test_registeredCall", func(msg dtx.DtxMessage) (interface{}, error) {
+				return "parsed", nil
+			})
+		}()
+		go func() {
+			defer wg.Done()
+			msg.ParseKnownCall()
+		}()
+	}
+	wg.Wait()
+	call, ok := msg.ParseKnownCall()
+	if assert.True(t, ok) {
+		assert.Equal(t, "parsed", call.Arguments)
+	}
+}
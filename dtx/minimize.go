@@ -0,0 +1,65 @@
+package dtx
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var errorNumbers = regexp.MustCompile(`[0-9]+`)
+
+//MinimizeFailure returns the shortest prefix of b that Decode rejects with the same kind of error as b itself,
+//a small reproducer to attach to bug reports. It returns nil if b decodes without error.
+func MinimizeFailure(b []byte) []byte {
+	_, _, err := Decode(b)
+	if err == nil {
+		return nil
+	}
+	class := errorClass(err)
+	for length := 0; length < len(b); length++ {
+		if _, _, err := Decode(b[:length]); err != nil && errorClass(err) == class {
+			return b[:length]
+		}
+	}
+	return b
+}
+
+//errorSentinels are the errors Decode wraps that tell failures within one stage apart
+var errorSentinels = []error{
+	ErrShortBuffer,
+	ErrIncompleteFrame,
+	ErrWrongMagic,
+	ErrBadHeaderLength,
+	ErrInvalidFragmentIndex,
+	ErrInconsistentPayloadHeader,
+	ErrAuxiliaryHeaderMismatch,
+	ErrChecksumMismatch,
+	ErrUnsupportedCompression,
+	ErrPayloadTooDeep,
+}
+
+//errorClass identifies the kind of a decode error by the stage it happened in and the sentinel error it wraps.
+//Errors without a sentinel are told apart by the part of their message before any details, ignoring the
+//numbers in it which depend on the input length.
+func errorClass(err error) string {
+	stage := "unknown"
+	var decodeError *DecodeError
+	if errors.As(err, &decodeError) {
+		stage = decodeError.Stage.String()
+		err = decodeError.Err
+	}
+	for _, sentinel := range errorSentinels {
+		if errors.Is(err, sentinel) {
+			return stage + "/" + sentinel.Error()
+		}
+	}
+	var unknown *UnknownPrimitiveTypeError
+	if errors.As(err, &unknown) {
+		return stage + "/unknown primitive type"
+	}
+	message := err.Error()
+	if i := strings.Index(message, ":"); i >= 0 {
+		message = message[:i]
+	}
+	return stage + "/" + errorNumbers.ReplaceAllString(message, "#")
+}
@@ -0,0 +1,51 @@
+package dtx_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMinimizeFailure(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	//the payload no longer starts with the plist magic
+	corrupt := append([]byte{}, dat...)
+	corrupt[48+binary.LittleEndian.Uint32(corrupt[36:])] = 'x'
+	capture := append(corrupt, dat...)
+	_, _, originalErr := dtx.Decode(capture)
+	if !assert.Error(t, originalErr) {
+		return
+	}
+
+	reproducer := dtx.MinimizeFailure(capture)
+	assert.Equal(t, corrupt, reproducer)
+	_, _, err = dtx.Decode(reproducer)
+	assert.Equal(t, originalErr.Error(), err.Error())
+
+	garbage := bytes.Repeat([]byte{0xab}, 1000)
+	reproducer = dtx.MinimizeFailure(garbage)
+	assert.Equal(t, 32, len(reproducer))
+	_, _, err = dtx.Decode(reproducer)
+	assert.Contains(t, err.Error(), "Wrong Magic")
+
+	//an AuxiliaryLength that does not fit the frame is a header failure like the truncated prefixes, but a different one
+	inconsistent := append([]byte{}, dat...)
+	binary.LittleEndian.PutUint32(inconsistent[36:], 10000)
+	_, _, originalErr = dtx.Decode(inconsistent)
+	assert.True(t, errors.Is(originalErr, dtx.ErrInconsistentPayloadHeader))
+	reproducer = dtx.MinimizeFailure(inconsistent)
+	assert.Equal(t, inconsistent, reproducer)
+	_, _, err = dtx.Decode(reproducer)
+	assert.True(t, errors.Is(err, dtx.ErrInconsistentPayloadHeader), "%v", err)
+
+	assert.Nil(t, dtx.MinimizeFailure(dat))
+}
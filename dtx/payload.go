@@ -0,0 +1,284 @@
+package dtx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/danielpaulus/nskeyedarchiver"
+	"howett.net/plist"
+)
+
+//PayloadFormat describes how the payload bytes of a DtxMessage are serialized.
+type PayloadFormat int
+
+const (
+	FormatUnknown PayloadFormat = iota
+	FormatKeyedArchive
+	FormatBinaryPlist
+)
+
+var (
+	binaryPlistMagic    = []byte("bplist00")
+	keyedArchiverMarker = []byte("NSKeyedArchiver")
+)
+
+func (f PayloadFormat) String() string {
+	switch f {
+	case FormatKeyedArchive:
+		return "NSKeyedArchive"
+	case FormatBinaryPlist:
+		return "BinaryPlist"
+	default:
+		return "Unknown"
+	}
+}
+
+//PayloadFormat inspects the raw payload bytes and tells whether they are an NSKeyedArchiver archive,
+//a plain binary plist or something else. Messages without a payload return FormatUnknown.
+func (d DtxMessage) PayloadFormat() PayloadFormat {
+	if !d.HasPayload() {
+		return FormatUnknown
+	}
+	payload, err := d.uncompressedPayload()
+	if err != nil {
+		return FormatUnknown
+	}
+	return detectPayloadFormat(payload)
+}
+
+//PayloadBytes returns the undecoded payload of a decoded message, nil if it has none. The result aliases the
+//bytes the message was decoded from and is still compressed if WasCompressed is true.
+func (d DtxMessage) PayloadBytes() []byte {
+	if !d.HasPayload() {
+		return nil
+	}
+	return d.payloadBytes()
+}
+
+//DecodePayload unarchives the payload of a message decoded with LazyPayload using DefaultPayloadCodec and stores it in Payload.
+//If Payload is already set it is returned as is.
+func (d *DtxMessage) DecodePayload() ([]interface{}, error) {
+	if d.Payload != nil || !d.HasPayload() {
+		return d.Payload, nil
+	}
+	payload, err := d.parsePayloadBytes(DefaultPayloadCodec)
+	if err != nil {
+		return nil, err
+	}
+	d.Payload = payload
+	return payload, nil
+}
+
+//payloadBytes returns the slice of rawBytes holding the payload
+func (d DtxMessage) payloadBytes() []byte {
+	offset := 48
+	if d.HasAuxiliary() {
+		offset += d.PayloadHeader.AuxiliaryLength
+	}
+	if offset > len(d.rawBytes) {
+		return nil
+	}
+	return d.rawBytes[offset:]
+}
+
+//detectPayloadFormat only looks at the plist magic and the archiver name, which are stored
+//as plain ASCII in binary plists. This is good enough to pick the right decoder.
+func detectPayloadFormat(payload []byte) PayloadFormat {
+	if !bytes.HasPrefix(payload, binaryPlistMagic) {
+		return FormatUnknown
+	}
+	if bytes.Contains(payload, keyedArchiverMarker) {
+		return FormatKeyedArchive
+	}
+	return FormatBinaryPlist
+}
+
+//DefaultMaxPayloadDepth is the nesting limit for payloads used when DecodeOptions.MaxPayloadDepth is 0.
+//Payloads seen from devices nest a handful of levels, this leaves plenty of room.
+const DefaultMaxPayloadDepth = 256
+
+//ErrPayloadTooDeep is returned for payloads nesting deeper than the configured maximum depth
+var ErrPayloadTooDeep = errors.New("payload nested too deeply")
+
+//PayloadCodec converts between the payload objects of a message and their serialized form. Auxiliary entries
+//are not affected, they always use the built in KeyedArchiveCodec.
+type PayloadCodec interface {
+	Unarchive(payload []byte) ([]interface{}, error)
+	Archive(objects []interface{}) ([]byte, error)
+}
+
+//KeyedArchiveCodec is the built in PayloadCodec. It unarchives NSKeyedArchiver archives with the nskeyedarchiver
+//library, also accepts plain binary plists and archives nil, primitives, []byte, []interface{} and map[string]interface{}.
+//Payloads nesting deeper than MaxDepth are rejected, 0 means DefaultMaxPayloadDepth or the DecodeOptions.MaxPayloadDepth.
+type KeyedArchiveCodec struct {
+	MaxDepth int
+}
+
+//Unarchive decodes a serialized payload.
+func (c KeyedArchiveCodec) Unarchive(payload []byte) ([]interface{}, error) {
+	maxDepth := c.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = DefaultMaxPayloadDepth
+	}
+	return decodePayload(payload, maxDepth)
+}
+
+//Archive serializes payload objects as an NSKeyedArchiver archive.
+func (c KeyedArchiveCodec) Archive(objects []interface{}) ([]byte, error) {
+	return archive(objects)
+}
+
+//DefaultPayloadCodec is used by Encode and by Decode unless DecodeOptions.PayloadCodec is set. Replace it to plug in
+//another archiver, for example a mock in tests.
+var DefaultPayloadCodec PayloadCodec = KeyedArchiveCodec{}
+
+func decodePayload(payload []byte, maxDepth int) ([]interface{}, error) {
+	switch detectPayloadFormat(payload) {
+	case FormatKeyedArchive:
+		//the unarchiver recurses along the object references, so they are checked before
+		if err := checkArchiveDepth(payload, maxDepth); err != nil {
+			return nil, err
+		}
+		return unarchive(payload)
+	case FormatBinaryPlist:
+		var result interface{}
+		_, err := plist.Unmarshal(payload, &result)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkValueDepth(result, 1, maxDepth); err != nil {
+			return nil, err
+		}
+		return []interface{}{result}, nil
+	default:
+		//XML archives and anything else the unarchiver accepted before the formats were told apart
+		prefix := payload
+		if len(prefix) > 8 {
+			prefix = prefix[:8]
+		}
+		if err := checkArchiveDepth(payload, maxDepth); err != nil {
+			return nil, fmt.Errorf("Unknown payload format %x: %w", prefix, err)
+		}
+		return unarchive(payload)
+	}
+}
+
+//unarchive turns the panics the nskeyedarchiver library raises for malformed archives into errors
+func unarchive(payload []byte) (result []interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			err = fmt.Errorf("Malformed NSKeyedArchiver archive: %v", r)
+		}
+	}()
+	return nskeyedarchiver.Unarchive(payload)
+}
+
+//checkArchiveDepth follows the object references of a keyed archive starting at $top and fails if they
+//nest deeper than maxDepth. Malformed archives pass, reporting those is left to the unarchiver.
+func checkArchiveDepth(payload []byte, maxDepth int) error {
+	var decoded interface{}
+	if _, err := plist.Unmarshal(payload, &decoded); err != nil {
+		return err
+	}
+	archive, _ := decoded.(map[string]interface{})
+	objects, _ := archive["$objects"].([]interface{})
+	top, _ := archive["$top"].(map[string]interface{})
+	walker := archiveDepthWalker{objects: objects, maxDepth: maxDepth, heights: map[plist.UID]int{}}
+	for _, root := range top {
+		if uid, ok := root.(plist.UID); ok {
+			if _, err := walker.height(uid, 1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type archiveDepthWalker struct {
+	objects  []interface{}
+	maxDepth int
+	//heights caches the nesting below objects already visited, archives often share objects
+	heights map[plist.UID]int
+}
+
+//height returns how many levels of objects are nested below and including uid, which sits at depth level.
+//Reference cycles are reported as too deep.
+func (w *archiveDepthWalker) height(uid plist.UID, level int) (int, error) {
+	if level > w.maxDepth {
+		return 0, fmt.Errorf("Payload exceeds the maximum depth of %d: %w", w.maxDepth, ErrPayloadTooDeep)
+	}
+	if height, ok := w.heights[uid]; ok {
+		if level+height-1 > w.maxDepth {
+			return 0, fmt.Errorf("Payload exceeds the maximum depth of %d: %w", w.maxDepth, ErrPayloadTooDeep)
+		}
+		return height, nil
+	}
+	if int(uid) >= len(w.objects) {
+		return 1, nil
+	}
+	result := 1
+	object, _ := w.objects[uid].(map[string]interface{})
+	for key, value := range object {
+		if key == "$class" {
+			continue
+		}
+		var children []interface{}
+		switch v := value.(type) {
+		case plist.UID:
+			children = []interface{}{v}
+		case []interface{}:
+			children = v
+		}
+		for _, child := range children {
+			childUID, ok := child.(plist.UID)
+			if !ok {
+				continue
+			}
+			height, err := w.height(childUID, level+1)
+			if err != nil {
+				return 0, err
+			}
+			if height+1 > result {
+				result = height + 1
+			}
+		}
+	}
+	w.heights[uid] = result
+	return result, nil
+}
+
+//checkValueDepth fails if arrays and dictionaries in value nest deeper than maxDepth
+func checkValueDepth(value interface{}, level int, maxDepth int) error {
+	if level > maxDepth {
+		return fmt.Errorf("Payload exceeds the maximum depth of %d: %w", maxDepth, ErrPayloadTooDeep)
+	}
+	switch v := value.(type) {
+	case []interface{}:
+		for _, entry := range v {
+			if err := checkValueDepth(entry, level+1, maxDepth); err != nil {
+				return err
+			}
+		}
+	case map[string]interface{}:
+		for _, entry := range v {
+			if err := checkValueDepth(entry, level+1, maxDepth); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//PayloadItems normalizes single and batched replies. If the only payload object is an array its elements
+//are returned, otherwise the single object is returned wrapped in a slice.
+func (d DtxMessage) PayloadItems() ([]interface{}, error) {
+	if len(d.Payload) != 1 {
+		return nil, fmt.Errorf("Expected exactly one payload object but got %d", len(d.Payload))
+	}
+	if items, ok := d.Payload[0].([]interface{}); ok {
+		return items, nil
+	}
+	return []interface{}{d.Payload[0]}, nil
+}
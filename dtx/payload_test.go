@@ -0,0 +1,204 @@
+package dtx_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+	"howett.net/plist"
+)
+
+func TestPayloadFormat(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	msg, _, err := dtx.Decode(dat)
+	if assert.NoError(t, err) {
+		assert.Equal(t, dtx.FormatKeyedArchive, msg.PayloadFormat())
+	}
+
+	payload, err := plist.Marshal("hello", plist.BinaryFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	msg, _, err = dtx.Decode(buildFrame(1, 1, nil, payload))
+	if assert.NoError(t, err) {
+		assert.Equal(t, dtx.FormatBinaryPlist, msg.PayloadFormat())
+		assert.Equal(t, []interface{}{"hello"}, msg.Payload)
+	}
+
+	assert.Equal(t, dtx.FormatUnknown, dtx.DtxMessage{}.PayloadFormat())
+}
+
+func TestPayloadItems(t *testing.T) {
+	for _, tc := range []struct {
+		payload  interface{}
+		expected []interface{}
+	}{
+		{[]interface{}{"a", uint64(1)}, []interface{}{"a", uint64(1)}},
+		{[]interface{}{}, []interface{}{}},
+		{"single", []interface{}{"single"}},
+	} {
+		frame, err := dtx.Encode(dtx.DtxMessage{Payload: []interface{}{tc.payload}})
+		if !assert.NoError(t, err) {
+			continue
+		}
+		msg, _, err := dtx.Decode(frame)
+		if assert.NoError(t, err) {
+			items, err := msg.PayloadItems()
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, items)
+		}
+	}
+	_, err := dtx.DtxMessage{}.PayloadItems()
+	assert.Error(t, err)
+}
+
+func TestMaxPayloadDepth(t *testing.T) {
+	nested := func(depth int) []interface{} {
+		var value interface{} = "leaf"
+		for i := 1; i < depth; i++ {
+			value = []interface{}{value}
+		}
+		return []interface{}{value}
+	}
+	tooDeep, err := dtx.Encode(dtx.DtxMessage{Payload: nested(dtx.DefaultMaxPayloadDepth + 1)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, _, err = dtx.Decode(tooDeep)
+	assert.True(t, errors.Is(err, dtx.ErrPayloadTooDeep), "unexpected error %v", err)
+
+	msg, _, err := dtx.DecodeWithOptions(tooDeep, dtx.DecodeOptions{MaxPayloadDepth: dtx.DefaultMaxPayloadDepth + 1})
+	if assert.NoError(t, err) {
+		assert.Equal(t, nested(dtx.DefaultMaxPayloadDepth+1), msg.Payload)
+	}
+
+	shallow, err := dtx.Encode(dtx.DtxMessage{Payload: nested(5)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, _, err = dtx.DecodeWithOptions(shallow, dtx.DecodeOptions{MaxPayloadDepth: 5})
+	assert.NoError(t, err)
+	_, _, err = dtx.DecodeWithOptions(shallow, dtx.DecodeOptions{MaxPayloadDepth: 4})
+	assert.True(t, errors.Is(err, dtx.ErrPayloadTooDeep), "unexpected error %v", err)
+}
+
+func TestLazyPayload(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	eager := decodeFixture("fixtures/requestChannelWithCode")
+	msg, _, err := dtx.DecodeWithOptions(dat, dtx.DecodeOptions{LazyPayload: true})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Nil(t, msg.Payload)
+	assert.Equal(t, eager.Identifier, msg.Identifier)
+	assert.Equal(t, eager.ChannelCode, msg.ChannelCode)
+	assert.Equal(t, eager.Auxiliary.String(), msg.Auxiliary.String())
+	assert.Equal(t, dat[48+msg.PayloadHeader.AuxiliaryLength:], msg.PayloadBytes())
+	payload, err := msg.DecodePayload()
+	assert.NoError(t, err)
+	assert.Equal(t, eager.Payload, payload)
+	assert.Equal(t, eager.Payload, msg.Payload)
+
+	//a payload the archiver cannot read does not keep a router from seeing the frame
+	frame := buildFrame(9, 4, nil, []byte("bplist00 but not really"))
+	_, _, err = dtx.Decode(frame)
+	assert.Error(t, err)
+	msg, _, err = dtx.DecodeWithOptions(frame, dtx.DecodeOptions{LazyPayload: true})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 9, msg.Identifier)
+		assert.Equal(t, 4, msg.ChannelCode)
+		assert.Equal(t, []byte("bplist00 but not really"), msg.PayloadBytes())
+		_, err = msg.DecodePayload()
+		assert.Error(t, err)
+	}
+
+	assert.Nil(t, dtx.NewKeepAlive(1).PayloadBytes())
+	keepAlive := dtx.NewKeepAlive(1)
+	payload, err = keepAlive.DecodePayload()
+	assert.NoError(t, err)
+	assert.Nil(t, payload)
+}
+
+//jsonCodec stands in for another archiver
+type jsonCodec struct{}
+
+func (jsonCodec) Unarchive(payload []byte) ([]interface{}, error) {
+	var result []interface{}
+	err := json.Unmarshal(payload, &result)
+	return result, err
+}
+
+func (jsonCodec) Archive(objects []interface{}) ([]byte, error) {
+	return json.Marshal(objects)
+}
+
+func TestPayloadCodec(t *testing.T) {
+	msg := dtx.DtxMessage{Identifier: 1, Payload: []interface{}{"selector:", 2.0}}
+	dtx.DefaultPayloadCodec = jsonCodec{}
+	frame, err := dtx.Encode(msg)
+	dtx.DefaultPayloadCodec = dtx.KeyedArchiveCodec{}
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `["selector:",2]`, string(frame[48:]))
+
+	_, _, err = dtx.Decode(frame)
+	assert.Error(t, err)
+	decoded, _, err := dtx.DecodeWithOptions(frame, dtx.DecodeOptions{PayloadCodec: jsonCodec{}})
+	if assert.NoError(t, err) {
+		assert.Equal(t, msg.Payload, decoded.Payload)
+	}
+
+	lazy, _, err := dtx.DecodeWithOptions(frame, dtx.DecodeOptions{LazyPayload: true})
+	assert.NoError(t, err)
+	dtx.DefaultPayloadCodec = jsonCodec{}
+	defer func() { dtx.DefaultPayloadCodec = dtx.KeyedArchiveCodec{} }()
+	payload, err := lazy.DecodePayload()
+	assert.NoError(t, err)
+	assert.Equal(t, msg.Payload, payload)
+}
+
+func TestKeyedArchiveCodec(t *testing.T) {
+	codec := dtx.KeyedArchiveCodec{}
+	archived, err := codec.Archive([]interface{}{map[string]interface{}{"a": "b"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	objects, err := codec.Unarchive(archived)
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{map[string]interface{}{"a": "b"}}, objects)
+
+	nested, err := codec.Archive([]interface{}{[]interface{}{[]interface{}{"deep"}}})
+	assert.NoError(t, err)
+	_, err = dtx.KeyedArchiveCodec{MaxDepth: 1}.Unarchive(nested)
+	assert.True(t, errors.Is(err, dtx.ErrPayloadTooDeep), "%v", err)
+}
+
+func TestDecodeXMLArchivePayload(t *testing.T) {
+	msg := decodeFixture("fixtures/requestChannelWithCode")
+	var archive interface{}
+	if _, err := plist.Unmarshal(msg.PayloadBytes(), &archive); err != nil {
+		log.Fatal(err)
+	}
+	xml, err := plist.Marshal(archive, plist.XMLFormat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	decoded, _, err := dtx.Decode(buildFrame(1, 1, nil, xml))
+	if assert.NoError(t, err) {
+		assert.Equal(t, msg.Payload, decoded.Payload)
+	}
+
+	_, _, err = dtx.Decode(buildFrame(1, 1, nil, []byte("no archive")))
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package dtx
+
+//RedactedPlaceholder replaces the values of redacted payload keys
+const RedactedPlaceholder = "<redacted>"
+
+//Redacted returns a copy of the message where the values of all dictionary keys named in keys are replaced
+//with RedactedPlaceholder, also in nested dictionaries and arrays. Archived objects in the auxiliary, where method
+//arguments live, are redacted and archived again. The raw bytes are dropped from the copy as they still contain
+//the original values.
+func (d DtxMessage) Redacted(keys []string) DtxMessage {
+	redact := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		redact[key] = true
+	}
+	result := d
+	result.rawBytes = nil
+	result.fragmentBytes = nil
+	result.rawAuxiliary = nil
+	if d.Payload != nil {
+		payload, _ := redactValue(d.Payload, redact)
+		result.Payload = payload.([]interface{})
+	}
+	result.Auxiliary = redactAuxiliary(d.Auxiliary, redact)
+	return result
+}
+
+func redactAuxiliary(aux DtxPrimitiveDictionary, keys map[string]bool) DtxPrimitiveDictionary {
+	if !aux.isPresent() {
+		return aux
+	}
+	result := NewPrimitiveDictionary()
+	for i, valueType := range aux.valueTypes {
+		value := aux.values[i]
+		switch valueType {
+		case t_dictionary:
+			value = redactAuxiliary(value.(DtxPrimitiveDictionary), keys)
+		case bytearray:
+			value = redactArchive(value.([]byte), keys)
+		}
+		result.add(valueType, value)
+	}
+	return result
+}
+
+//redactArchive returns b unchanged if it is no archive or holds none of keys. If the redacted object cannot be
+//archived again, the whole entry is replaced by an archived RedactedPlaceholder.
+func redactArchive(b []byte, keys map[string]bool) []byte {
+	objects, err := decodePayload(b, DefaultMaxPayloadDepth)
+	if err != nil {
+		return b
+	}
+	redacted, changed := redactValue(objects, keys)
+	if !changed {
+		return b
+	}
+	result, err := archive(redacted.([]interface{}))
+	if err != nil {
+		result, _ = archive([]interface{}{RedactedPlaceholder})
+	}
+	return result
+}
+
+//redactValue also tells if anything was redacted
+func redactValue(value interface{}, keys map[string]bool) (interface{}, bool) {
+	changed := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, entry := range v {
+			if keys[key] {
+				result[key] = RedactedPlaceholder
+				changed = true
+				continue
+			}
+			redacted, entryChanged := redactValue(entry, keys)
+			result[key] = redacted
+			changed = changed || entryChanged
+		}
+		return result, changed
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, entry := range v {
+			redacted, entryChanged := redactValue(entry, keys)
+			result[i] = redacted
+			changed = changed || entryChanged
+		}
+		return result, changed
+	default:
+		return value, false
+	}
+}
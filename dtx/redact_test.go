@@ -0,0 +1,72 @@
+package dtx_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedacted(t *testing.T) {
+	msg := dtx.DtxMessage{Payload: []interface{}{map[string]interface{}{
+		"token": "secret",
+		"name":  "visible",
+		"nested": []interface{}{
+			map[string]interface{}{"token": "secret too", "other": 1},
+		},
+	}}}
+
+	redacted := msg.Redacted([]string{"token"})
+	payload := redacted.Payload[0].(map[string]interface{})
+	assert.Equal(t, dtx.RedactedPlaceholder, payload["token"])
+	assert.Equal(t, "visible", payload["name"])
+	nested := payload["nested"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, dtx.RedactedPlaceholder, nested["token"])
+	assert.Equal(t, 1, nested["other"])
+
+	assert.Equal(t, "secret", msg.Payload[0].(map[string]interface{})["token"])
+}
+
+func TestRedactedAuxiliary(t *testing.T) {
+	nested := dtx.NewPrimitiveDictionary()
+	nested.AddBytes(archiveValue(map[string]interface{}{"token": "nested secret"}))
+	aux := dtx.NewPrimitiveDictionary()
+	aux.AddBytes(archiveValue(map[string]interface{}{"token": "secret", "path": "/tmp"}))
+	aux.AddInt32(7)
+	aux.AddBytes([]byte{0xde, 0xad})
+	aux.AddDictionary(nested)
+	auxBytes, err := aux.Encode()
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg, _, err := dtx.Decode(buildFrame(1, 1, auxBytes, nil))
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg.SetRawAuxiliary(msg.RawBytes()[48 : 48+msg.PayloadHeader.AuxiliaryLength])
+
+	redacted := msg.Redacted([]string{"token"})
+	object, err := redacted.Auxiliary.GetObject(0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{"token": dtx.RedactedPlaceholder, "path": "/tmp"}, object)
+	}
+	number, err := redacted.Auxiliary.GetInt32(1)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(7), number)
+	raw, err := redacted.Auxiliary.GetBytes(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xde, 0xad}, raw)
+	assert.Nil(t, redacted.RawBytes())
+
+	frame, err := dtx.Encode(redacted)
+	if assert.NoError(t, err) {
+		assert.False(t, bytes.Contains(frame, []byte("secret")))
+	}
+	assert.NotContains(t, redacted.String(), "secret")
+
+	object, err = msg.Auxiliary.GetObject(0)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "secret", object.(map[string]interface{})["token"])
+	}
+}
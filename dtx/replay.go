@@ -0,0 +1,75 @@
+package dtx
+
+import (
+	"fmt"
+	"time"
+)
+
+//TimedMessage is a message of a recorded session together with the time it was captured.
+type TimedMessage struct {
+	Timestamp time.Time
+	Message   DtxMessage
+}
+
+//ReplaySession sends the messages of entries over conn, waiting between frames as long as the
+//original capture did. For every message that expects a reply, incoming messages are read until a ReplyTracker
+//matches its reply. If remap is set, identifiers are replaced with fresh ones from conn, messages that shared
+//an identifier in the capture still share one after remapping.
+//Replaying stops at the first write or read error, the error tells which frame failed.
+func ReplaySession(conn *Conn, entries []TimedMessage, remap bool) error {
+	identifiers := map[int]int{}
+	var tracker ReplyTracker
+	for i, entry := range entries {
+		if i > 0 {
+			time.Sleep(entry.Timestamp.Sub(entries[i-1].Timestamp))
+		}
+		msg := entry.Message
+		if remap {
+			identifier, ok := identifiers[msg.Identifier]
+			if !ok {
+				identifier = conn.NextIdentifier()
+				identifiers[msg.Identifier] = identifier
+			}
+			msg.Identifier = identifier
+		}
+		err := conn.Send(msg)
+		if err != nil {
+			return fmt.Errorf("Failed sending frame %d (%s): %w", i, msg, err)
+		}
+		if !msg.ExpectsReply {
+			continue
+		}
+		tracker.RegisterRequest(msg)
+		for {
+			reply, err := conn.Receive()
+			if err != nil {
+				return fmt.Errorf("Failed reading reply for frame %d (%s): %w", i, msg, err)
+			}
+			if _, matched := tracker.MatchReply(reply); matched {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+//ReplyLatencies maps the Identifier of every request in entries to the time it took until the first reply
+//with the same Identifier arrived. Requests without a reply are left out.
+func ReplyLatencies(entries []TimedMessage) map[int]time.Duration {
+	requests := map[int]time.Time{}
+	result := map[int]time.Duration{}
+	for _, entry := range entries {
+		msg := entry.Message
+		if msg.ConversationIndex == 0 {
+			if msg.ExpectsReply {
+				requests[msg.Identifier] = entry.Timestamp
+			}
+			continue
+		}
+		if sent, ok := requests[msg.Identifier]; ok {
+			result[msg.Identifier] = entry.Timestamp.Sub(sent)
+			delete(requests, msg.Identifier)
+		}
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package dtx_test
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+//replyingTransport records written frames and answers every frame expecting a reply with an ack
+type replyingTransport struct {
+	written []dtx.DtxMessage
+	replies [][]byte
+}
+
+func (r *replyingTransport) WriteFrame(frame []byte) error {
+	msg, _, err := dtx.Decode(frame)
+	if err != nil {
+		return err
+	}
+	r.written = append(r.written, msg)
+	if msg.ExpectsReply {
+		reply, err := dtx.Encode(dtx.DtxMessage{Identifier: msg.Identifier, ConversationIndex: 1, ChannelCode: msg.ChannelCode})
+		if err != nil {
+			return err
+		}
+		r.replies = append(r.replies, reply)
+	}
+	return nil
+}
+
+func (r *replyingTransport) ReadFrame() ([]byte, error) {
+	if len(r.replies) == 0 {
+		return nil, io.EOF
+	}
+	reply := r.replies[0]
+	r.replies = r.replies[1:]
+	return reply, nil
+}
+
+func TestReplaySession(t *testing.T) {
+	start := time.Now()
+	invocation := func(identifier int, expectsReply bool) dtx.DtxMessage {
+		return dtx.DtxMessage{Identifier: identifier, ChannelCode: 1, ExpectsReply: expectsReply,
+			PayloadHeader: dtx.DtxPayloadHeader{MessageType: dtx.MethodInvocationWithExpectedReply}, Payload: []interface{}{"selector"}}
+	}
+	entries := []dtx.TimedMessage{
+		{Timestamp: start, Message: invocation(20, true)},
+		{Timestamp: start.Add(5 * time.Millisecond), Message: invocation(21, false)},
+		{Timestamp: start.Add(10 * time.Millisecond), Message: invocation(22, true)},
+	}
+	transport := &replyingTransport{}
+
+	err := dtx.ReplaySession(dtx.NewConn(transport), entries, true)
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+	if assert.Equal(t, 3, len(transport.written)) {
+		for i, msg := range transport.written {
+			assert.Equal(t, i+1, msg.Identifier)
+			assert.Equal(t, entries[i].Message.ExpectsReply, msg.ExpectsReply)
+		}
+	}
+
+	//if the device invocation ended the wait, the last reply would still be queued
+	interleaving := &interleavingTransport{&replyingTransport{}}
+	err = dtx.ReplaySession(dtx.NewConn(interleaving), entries, true)
+	assert.NoError(t, err)
+	assert.Empty(t, interleaving.replies)
+
+	err = dtx.ReplaySession(dtx.NewConn(&noReplyTransport{&replyingTransport{}}), entries, false)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "frame 0")
+		assert.True(t, errors.Is(err, io.EOF))
+	}
+}
+
+//interleavingTransport makes the device invoke a method with the Identifier of every request before replying to it
+type interleavingTransport struct {
+	*replyingTransport
+}
+
+func (i *interleavingTransport) WriteFrame(frame []byte) error {
+	msg, _, err := dtx.Decode(frame)
+	if err != nil {
+		return err
+	}
+	if msg.ExpectsReply {
+		invocation, err := dtx.Encode(dtx.DtxMessage{Identifier: msg.Identifier, ChannelCode: -msg.ChannelCode,
+			PayloadHeader: dtx.DtxPayloadHeader{MessageType: dtx.MethodinvocationWithoutExpectedReply}, Payload: []interface{}{"deviceSelector"}})
+		if err != nil {
+			return err
+		}
+		i.replies = append(i.replies, invocation)
+	}
+	return i.replyingTransport.WriteFrame(frame)
+}
+
+//noReplyTransport swallows all replies to make the replay fail
+type noReplyTransport struct {
+	*replyingTransport
+}
+
+func (n *noReplyTransport) ReadFrame() ([]byte, error) {
+	return nil, io.EOF
+}
+
+func TestReplyLatencies(t *testing.T) {
+	start := time.Now()
+	entries := []dtx.TimedMessage{
+		{Timestamp: start, Message: dtx.DtxMessage{Identifier: 1, ExpectsReply: true}},
+		{Timestamp: start.Add(time.Millisecond), Message: dtx.DtxMessage{Identifier: 2, ExpectsReply: true}},
+		{Timestamp: start.Add(2 * time.Millisecond), Message: dtx.DtxMessage{Identifier: 3}},
+		{Timestamp: start.Add(30 * time.Millisecond), Message: dtx.DtxMessage{Identifier: 1, ConversationIndex: 1}},
+		{Timestamp: start.Add(40 * time.Millisecond), Message: dtx.DtxMessage{Identifier: 1, ConversationIndex: 2}},
+	}
+	latencies := dtx.ReplyLatencies(entries)
+	assert.Equal(t, map[int]time.Duration{1: 30 * time.Millisecond}, latencies)
+}
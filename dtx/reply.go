@@ -0,0 +1,52 @@
+package dtx
+
+import (
+	"fmt"
+	"sync"
+)
+
+//ReplyValue returns both halves of a reply: the return value, which is the only payload object, and the
+//out parameters in the auxiliary. The value is nil for replies without payload and the dictionary is empty
+//for replies without auxiliary.
+func (d DtxMessage) ReplyValue() (interface{}, DtxPrimitiveDictionary, error) {
+	switch len(d.Payload) {
+	case 0:
+		return nil, d.Auxiliary, nil
+	case 1:
+		return d.Payload[0], d.Auxiliary, nil
+	default:
+		return nil, DtxPrimitiveDictionary{}, fmt.Errorf("Reply %s has %d payload objects, expected one return value", d, len(d.Payload))
+	}
+}
+
+//ReplyTracker matches replies to the requests they answer. A reply reuses the Identifier of its request and
+//increments the ConversationIndex. The zero value is ready to use and it is safe for concurrent use, so requests
+//can be registered by the sending goroutine while another one reads replies.
+type ReplyTracker struct {
+	mutex       sync.Mutex
+	outstanding map[int]DtxMessage
+}
+
+//RegisterRequest remembers msg until its reply arrives. Registering another request with the same Identifier
+//replaces the earlier one.
+func (t *ReplyTracker) RegisterRequest(msg DtxMessage) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.outstanding == nil {
+		t.outstanding = map[int]DtxMessage{}
+	}
+	t.outstanding[msg.Identifier] = msg
+}
+
+//MatchReply returns the request msg replies to and forgets about it. matched is false if msg is no reply to
+//a registered request.
+func (t *ReplyTracker) MatchReply(msg DtxMessage) (original DtxMessage, matched bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	request, ok := t.outstanding[msg.Identifier]
+	if !ok || msg.ConversationIndex != request.ConversationIndex+1 {
+		return DtxMessage{}, false
+	}
+	delete(t.outstanding, msg.Identifier)
+	return request, true
+}
@@ -0,0 +1,75 @@
+package dtx_test
+
+import (
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplyValue(t *testing.T) {
+	aux := dtx.NewPrimitiveDictionary()
+	aux.AddInt32(42)
+	frame, err := dtx.Encode(dtx.DtxMessage{Identifier: 5, ConversationIndex: 1, Auxiliary: aux,
+		Payload: []interface{}{map[string]interface{}{"pid": 123}}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	reply, _, err := dtx.Decode(frame)
+	if !assert.NoError(t, err) {
+		return
+	}
+	value, outParameters, err := reply.ReplyValue()
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]interface{}{"pid": uint64(123)}, value)
+		assert.Equal(t, 1, outParameters.Len())
+		assert.Equal(t, aux.String(), outParameters.String())
+	}
+
+	frame, err = dtx.Encode(dtx.DtxMessage{Identifier: 5, ConversationIndex: 1, Payload: []interface{}{"done"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	reply, _, err = dtx.Decode(frame)
+	if !assert.NoError(t, err) {
+		return
+	}
+	value, outParameters, err = reply.ReplyValue()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "done", value)
+		assert.Equal(t, 0, outParameters.Len())
+	}
+
+	_, _, err = dtx.DtxMessage{Payload: []interface{}{"a", "b"}}.ReplyValue()
+	assert.Error(t, err)
+}
+
+func TestReplyTracker(t *testing.T) {
+	var tracker dtx.ReplyTracker
+	request, err := dtx.BuildMethodInvocation("runningProcesses", 2, nil, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	request.Identifier = 5
+	tracker.RegisterRequest(request)
+	other := request
+	other.Identifier = 6
+	tracker.RegisterRequest(other)
+
+	_, matched := tracker.MatchReply(dtx.BuildAck(7, 1, -2))
+	assert.False(t, matched)
+	_, matched = tracker.MatchReply(dtx.BuildAck(5, 0, -2))
+	assert.False(t, matched, "a message with the same ConversationIndex is no reply")
+	_, matched = tracker.MatchReply(dtx.BuildAck(5, 2, -2))
+	assert.False(t, matched)
+
+	original, matched := tracker.MatchReply(dtx.BuildAck(5, 1, -2))
+	if assert.True(t, matched) {
+		assert.True(t, request.Equal(original))
+	}
+	_, matched = tracker.MatchReply(dtx.BuildAck(5, 1, -2))
+	assert.False(t, matched, "a request is only matched once")
+	original, matched = tracker.MatchReply(dtx.BuildAck(6, 1, -2))
+	assert.True(t, matched)
+	assert.Equal(t, 6, original.Identifier)
+}
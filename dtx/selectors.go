@@ -0,0 +1,100 @@
+package dtx
+
+import (
+	"fmt"
+	"strings"
+)
+
+//channelTeardownSelectors are sent by the device when a service channel is closed
+var channelTeardownSelectors = map[string]bool{
+	"_channelCanceled:": true,
+}
+
+//selector returns the method name of a method invocation, which is the only object in the payload.
+func (d DtxMessage) selector() (string, bool) {
+	if len(d.Payload) == 0 {
+		return "", false
+	}
+	selector, ok := d.Payload[0].(string)
+	return selector, ok
+}
+
+//MethodCall returns the selector and the decoded arguments of a method invocation, see GetArguments for
+//how the auxiliary entries are converted. ok is false for all messages but method invocations, see IsMethodInvocation.
+func (d DtxMessage) MethodCall() (selector string, args []interface{}, ok bool) {
+	if !d.IsMethodInvocation() {
+		return "", nil, false
+	}
+	selector, ok = d.selector()
+	if !ok {
+		return "", nil, false
+	}
+	return selector, d.Auxiliary.GetArguments(), true
+}
+
+//IsChannelTeardown tells if the message announces that a channel was closed, so per channel state can be released.
+func (d DtxMessage) IsChannelTeardown() bool {
+	selector, ok := d.selector()
+	return ok && channelTeardownSelectors[selector]
+}
+
+//Signature combines the selector and the types of the auxiliary arguments into a string like "selector(i32,str,object)",
+//which allows dispatching on the shape of a call. The argument types are:
+//  - null, i32, i64, f64, u64 and dict for the primitive types
+//  - str, i64, f64 and bool for archived strings and numbers, data for archived NSData, object for other archived objects
+//  - bytes for binary arguments that are no archive
+func (d DtxMessage) Signature() (string, error) {
+	selector, ok := d.selector()
+	if !ok {
+		return "", fmt.Errorf("Message %s is no method invocation", d)
+	}
+	types := make([]string, d.Auxiliary.Len())
+	for i := range types {
+		argumentType, err := d.Auxiliary.signatureType(i)
+		if err != nil {
+			return "", err
+		}
+		types[i] = argumentType
+	}
+	return fmt.Sprintf("%s(%s)", selector, strings.Join(types, ",")), nil
+}
+
+func (d DtxPrimitiveDictionary) signatureType(index int) (string, error) {
+	t, err := d.Type(index)
+	if err != nil {
+		return "", err
+	}
+	switch t {
+	case TypeNull:
+		return "null", nil
+	case TypeUint32:
+		return "i32", nil
+	case TypeInt64:
+		return "i64", nil
+	case TypeFloat64:
+		return "f64", nil
+	case TypeDictionary:
+		return "dict", nil
+	case TypeData:
+		return "data", nil
+	case TypeBytes:
+		object, err := d.unarchive(index)
+		if err != nil {
+			return "bytes", nil
+		}
+		switch object.(type) {
+		case string:
+			return "str", nil
+		case uint64, int64:
+			return "i64", nil
+		case float64:
+			return "f64", nil
+		case bool:
+			return "bool", nil
+		default:
+			return "object", nil
+		}
+	default:
+		return "", fmt.Errorf("Entry %d has the unsupported type %s", index, t)
+	}
+}
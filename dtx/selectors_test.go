@@ -0,0 +1,81 @@
+package dtx_test
+
+import (
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsChannelTeardown(t *testing.T) {
+	aux := dtx.DtxPrimitiveDictionary{}
+	aux.AddInt32(5)
+	frame, err := dtx.Encode(dtx.DtxMessage{Identifier: 9, Auxiliary: aux, Payload: []interface{}{"_channelCanceled:"},
+		PayloadHeader: dtx.DtxPayloadHeader{MessageType: dtx.MethodinvocationWithoutExpectedReply}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg, _, err := dtx.Decode(frame)
+	if assert.NoError(t, err) {
+		assert.True(t, msg.IsChannelTeardown())
+	}
+	assert.False(t, decodeFixture("fixtures/requestChannelWithCode").IsChannelTeardown())
+	assert.False(t, dtx.DtxMessage{}.IsChannelTeardown())
+}
+
+func TestSignature(t *testing.T) {
+	signature, err := decodeFixture("fixtures/requestChannelWithCode").Signature()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "_requestChannelWithCode:identifier:(i32,str)", signature)
+	}
+
+	aux := dtx.NewPrimitiveDictionary()
+	aux.AddBytes(archiveValue(7))
+	aux.AddBytes(archiveValue("name"))
+	aux.AddBytes(archiveValue(map[string]interface{}{"key": "value"}))
+	aux.AddNull()
+	aux.AddBytes([]byte{1, 2, 3})
+	frame, err := dtx.Encode(dtx.DtxMessage{Identifier: 1, Auxiliary: aux, Payload: []interface{}{"launch:name:options:"},
+		PayloadHeader: dtx.DtxPayloadHeader{MessageType: dtx.MethodInvocationWithExpectedReply}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	msg, _, err := dtx.Decode(frame)
+	if !assert.NoError(t, err) {
+		return
+	}
+	signature, err = msg.Signature()
+	if assert.NoError(t, err) {
+		assert.Equal(t, "launch:name:options:(i64,str,object,null,bytes)", signature)
+	}
+
+	_, err = dtx.NewKeepAlive(1).Signature()
+	assert.Error(t, err)
+}
+
+func TestMethodCall(t *testing.T) {
+	selector, args, ok := decodeFixture("fixtures/requestChannelWithCode").MethodCall()
+	if assert.True(t, ok) {
+		assert.Equal(t, "_requestChannelWithCode:identifier:", selector)
+		assert.Equal(t, []interface{}{int32(1), "dtxproxy:XCTestManager_IDEInterface:XCTestManager_DaemonConnectionInterface"}, args)
+	}
+
+	call, err := dtx.BuildMethodInvocation("setConfig:", 2, []interface{}{int64(-1), nil, "x"}, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	frame, err := dtx.Encode(call)
+	assert.NoError(t, err)
+	decoded, _, err := dtx.Decode(frame)
+	assert.NoError(t, err)
+	selector, args, ok = decoded.MethodCall()
+	if assert.True(t, ok) {
+		assert.Equal(t, "setConfig:", selector)
+		assert.Equal(t, []interface{}{int64(-1), nil, "x"}, args)
+	}
+
+	_, _, ok = dtx.BuildAck(1, 1, 2).MethodCall()
+	assert.False(t, ok)
+	_, _, ok = dtx.DtxMessage{PayloadHeader: dtx.DtxPayloadHeader{MessageType: dtx.MethodInvocationWithExpectedReply}}.MethodCall()
+	assert.False(t, ok)
+}
@@ -0,0 +1,99 @@
+package dtx
+
+import "fmt"
+
+//SplitByChannel groups the messages of a session by ChannelCode. The order of messages within a channel is preserved.
+func SplitByChannel(msgs []DtxMessage) map[int][]DtxMessage {
+	result := map[int][]DtxMessage{}
+	for _, msg := range msgs {
+		result[msg.ChannelCode] = append(result[msg.ChannelCode], msg)
+	}
+	return result
+}
+
+//StripAcks returns the messages of a session that are not acks, keeping their order.
+func StripAcks(msgs []DtxMessage) []DtxMessage {
+	result := make([]DtxMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		if msg.IsAck() {
+			continue
+		}
+		result = append(result, msg)
+	}
+	return result
+}
+
+//Protocol variants DetectVersion can tell apart
+const (
+	VersionStandard     = "standard"
+	Version64BitLengths = "64-bit-lengths"
+)
+
+//DetectVersion makes a best effort guess which DTX variant produced a capture by looking at the AuxiliaryHeader
+//of all messages carrying an auxiliary:
+//  - standard: AuxiliarySize equals AuxiliaryLength minus the 16 header bytes
+//  - 64-bit-lengths: the fields that are always zero in the standard layout are used, meaning sizes are written as uint64
+//The variant seen most often wins. An error is returned if no message carries an auxiliary. Frames of peers that
+//leave out the AuxiliaryHeader cannot be decoded at all, so such a variant is not detected.
+func DetectVersion(msgs []DtxMessage) (string, error) {
+	votes := map[string]int{}
+	for _, msg := range msgs {
+		if !msg.HasAuxiliary() {
+			continue
+		}
+		header := msg.AuxiliaryHeader
+		switch {
+		case int(header.AuxiliarySize)+16 == msg.PayloadHeader.AuxiliaryLength:
+			votes[VersionStandard]++
+		case header.Unknown != 0 || header.Unknown2 != 0:
+			votes[Version64BitLengths]++
+		}
+	}
+	result := ""
+	for _, version := range []string{VersionStandard, Version64BitLengths} {
+		if votes[version] > votes[result] {
+			result = version
+		}
+	}
+	if result == "" {
+		return "", fmt.Errorf("Cannot detect DTX version, none of the %d messages has a recognizable auxiliary", len(msgs))
+	}
+	return result, nil
+}
+
+//MergeCapabilities collects the capabilities of all "_notifyOfPublishedCapabilities:" messages of a session into one map.
+//The host publishes its capabilities first and the device answers with its own, so for a key announced twice the value of
+//the later message wins, which prefers the device's value.
+func MergeCapabilities(msgs []DtxMessage) (map[string]int, error) {
+	result := map[string]int{}
+	for _, msg := range msgs {
+		if selector, ok := msg.selector(); !ok || selector != "_notifyOfPublishedCapabilities:" {
+			continue
+		}
+		call, err := parseNotifyCapabilitiesCall(msg)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid capabilities in message %s: %w", msg, err)
+		}
+		for name, value := range call.(*NotifyCapabilitiesCall).Capabilities {
+			version, ok := capabilityVersion(value)
+			if !ok {
+				return nil, fmt.Errorf("Capability %s has the non integer value %v in message %s", name, value, msg)
+			}
+			result[name] = version
+		}
+	}
+	return result, nil
+}
+
+func capabilityVersion(value interface{}) (int, bool) {
+	switch v := value.(type) {
+	case uint64:
+		return int(v), true
+	case int64:
+		return int(v), true
+	case int:
+		return v, true
+	default:
+		return 0, false
+	}
+}
@@ -0,0 +1,115 @@
+package dtx_test
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"log"
+	"testing"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitByChannel(t *testing.T) {
+	session := []dtx.DtxMessage{
+		{Identifier: 1, ChannelCode: 0},
+		{Identifier: 2, ChannelCode: 5},
+		{Identifier: 3, ChannelCode: 0},
+		{Identifier: 4, ChannelCode: -5},
+		{Identifier: 5, ChannelCode: 5},
+	}
+	channels := dtx.SplitByChannel(session)
+	assert.Equal(t, 3, len(channels))
+	identifiers := func(msgs []dtx.DtxMessage) []int {
+		result := []int{}
+		for _, msg := range msgs {
+			result = append(result, msg.Identifier)
+		}
+		return result
+	}
+	assert.Equal(t, []int{1, 3}, identifiers(channels[0]))
+	assert.Equal(t, []int{2, 5}, identifiers(channels[5]))
+	assert.Equal(t, []int{4}, identifiers(channels[-5]))
+}
+
+func TestDetectVersion(t *testing.T) {
+	standard := []dtx.DtxMessage{
+		decodeFixture("fixtures/notifyOfPublishedCapabilites"),
+		decodeFixture("fixtures/requestChannelWithCode"),
+	}
+	version, err := dtx.DetectVersion(standard)
+	if assert.NoError(t, err) {
+		assert.Equal(t, dtx.VersionStandard, version)
+	}
+
+	//sizes written as uint64 leave the upper halves in the unknown fields
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(dat[52:], 1)
+	binary.LittleEndian.PutUint32(dat[56:], 0)
+	wide, _, err := dtx.Decode(dat)
+	if assert.NoError(t, err) {
+		version, err = dtx.DetectVersion([]dtx.DtxMessage{wide})
+		if assert.NoError(t, err) {
+			assert.Equal(t, dtx.Version64BitLengths, version)
+		}
+	}
+
+	_, err = dtx.DetectVersion([]dtx.DtxMessage{{}})
+	assert.Error(t, err)
+}
+
+func TestStripAcks(t *testing.T) {
+	invocation := dtx.DtxPayloadHeader{MessageType: dtx.MethodInvocationWithExpectedReply}
+	ack := dtx.DtxPayloadHeader{MessageType: dtx.Ack}
+	session := []dtx.DtxMessage{
+		{Identifier: 1, PayloadHeader: invocation},
+		{Identifier: 1, ConversationIndex: 1, PayloadHeader: ack},
+		{Identifier: 2, PayloadHeader: invocation},
+		{Identifier: 3, PayloadHeader: invocation},
+		{Identifier: 3, ConversationIndex: 1, PayloadHeader: ack},
+	}
+	stripped := dtx.StripAcks(session)
+	if assert.Equal(t, 3, len(stripped)) {
+		for i, msg := range stripped {
+			assert.Equal(t, i+1, msg.Identifier)
+		}
+	}
+
+	frames, err := dtx.EncodeFragmented(decodeFixture("fixtures/requestChannelWithCode"), 100)
+	if !assert.NoError(t, err) {
+		return
+	}
+	fragments := decodeFragments(frames)
+	assert.Equal(t, fragments, dtx.StripAcks(fragments))
+}
+
+func TestMergeCapabilities(t *testing.T) {
+	host := decodeFixture("fixtures/notifyOfPublishedCapabilites")
+	aux := dtx.NewPrimitiveDictionary()
+	aux.AddBytes(archiveValue(map[string]interface{}{
+		"com.apple.private.DTXConnection":       2,
+		"com.apple.instruments.server.services": 1,
+	}))
+	device := dtx.DtxMessage{Identifier: 1, Auxiliary: aux, Payload: []interface{}{"_notifyOfPublishedCapabilities:"},
+		PayloadHeader: dtx.DtxPayloadHeader{MessageType: dtx.MethodinvocationWithoutExpectedReply}}
+	frame, err := dtx.Encode(device)
+	if !assert.NoError(t, err) {
+		return
+	}
+	device, _, err = dtx.Decode(frame)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	capabilities, err := dtx.MergeCapabilities([]dtx.DtxMessage{host, dtx.NewKeepAlive(0), device})
+	if assert.NoError(t, err) {
+		assert.Equal(t, map[string]int{
+			"com.apple.private.DTXBlockCompression": 2,
+			"com.apple.private.DTXConnection":       2,
+			"com.apple.instruments.server.services": 1,
+		}, capabilities)
+	}
+}
@@ -0,0 +1,222 @@
+package dtx
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+//Decoder reads DtxMessages one at a time from an underlying source.
+type Decoder struct {
+	transport frameReader
+	drop      func(msg DtxMessage) bool
+	sequence  int
+	pending   chan frameResult
+	assembler FragmentAssembler
+	options   DecodeOptions
+}
+
+//frameResult is the outcome of a ReadFrame that outlived the context it was started with
+type frameResult struct {
+	frame []byte
+	err   error
+}
+
+//DecoderFromTransport creates a Decoder that reads one complete frame per ReadFrame call from t.
+func DecoderFromTransport(t Transport) *Decoder {
+	return &Decoder{transport: t}
+}
+
+//NewDecoder creates a Decoder reading frames from a byte stream like a device connection. Reads are buffered,
+//so more bytes than the returned frames may be consumed from r. Decode returns io.EOF if r ends between two frames
+//and io.ErrUnexpectedEOF if it ends within a frame. Fragmented messages are returned one fragment at a time,
+//use DecodeMessage or a FragmentAssembler to put them together.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{transport: &streamReader{reader: bufio.NewReader(r)}}
+}
+
+//NewDecoderBuffer works like NewDecoder but reads every frame into buf, which is grown if a frame does not fit,
+//instead of allocating a new slice per frame. Like with Decode, the raw and fragment bytes and the binary
+//auxiliary entries of a returned message alias that buffer, so they are only valid until the next call to Decode.
+//Use it for high throughput channels where messages are processed one at a time.
+func NewDecoderBuffer(r io.Reader, buf []byte) *Decoder {
+	return &Decoder{transport: &streamReader{reader: bufio.NewReader(r), buf: buf, reuse: true}}
+}
+
+//SetFilter makes Decode skip all messages for which drop returns true, for example acks when only
+//meaningful traffic is of interest. Passing nil returns all messages again.
+func (d *Decoder) SetFilter(drop func(msg DtxMessage) bool) {
+	d.drop = drop
+}
+
+//SetOptions makes Decode apply options to every frame. For Decoders created by NewDecoder and NewDecoderBuffer the
+//options also decide where a frame ends, so they have to be set before the first call to Decode.
+func (d *Decoder) SetOptions(options DecodeOptions) {
+	d.options = options
+	d.assembler.Options = options
+	if stream, ok := d.transport.(*streamReader); ok {
+		stream.options = options
+	}
+}
+
+//Decode returns the next message that is not dropped by the filter. Dropped messages still count for the Sequence. Errors from the underlying source are returned unchanged.
+func (d *Decoder) Decode() (DtxMessage, error) {
+	return d.DecodeContext(context.Background())
+}
+
+//DecodeContext works like Decode but returns the error of ctx once it is cancelled or its deadline passes.
+//The Decoder stays usable after that: the interrupted read keeps running in the background and the next call
+//to Decode or DecodeContext continues with it, so no bytes are lost and frames are returned in order.
+//A Decoder must not be used from several goroutines at once.
+func (d *Decoder) DecodeContext(ctx context.Context) (DtxMessage, error) {
+	for {
+		msg, err := d.decodeFrame(ctx)
+		if err != nil {
+			return DtxMessage{}, err
+		}
+		if d.drop == nil || !d.drop(msg) {
+			return msg, nil
+		}
+	}
+}
+
+//DecodeMessage works like Decode but puts fragmented messages back together, so only complete messages with a fully
+//parsed auxiliary and payload are returned. Messages that are not fragmented are returned as they are read. The filter
+//sees the complete messages and the Sequence of an assembled message is the one of its last fragment. The options set
+//with SetOptions apply to assembled messages as well, one whose payload cannot be decoded is returned with a PayloadError.
+//Do not mix calls to Decode and DecodeMessage on one Decoder, fragments returned by Decode are not assembled.
+func (d *Decoder) DecodeMessage() (DtxMessage, error) {
+	for {
+		fragment, err := d.decodeFrame(context.Background())
+		if err != nil {
+			return DtxMessage{}, err
+		}
+		msg, done, err := d.assembler.Add(fragment)
+		var payloadError *PayloadError
+		if errors.As(err, &payloadError) {
+			msg.Sequence = fragment.Sequence
+			return msg, err
+		}
+		if err != nil {
+			return DtxMessage{}, err
+		}
+		if !done {
+			continue
+		}
+		msg.Sequence = fragment.Sequence
+		if d.drop == nil || !d.drop(msg) {
+			return msg, nil
+		}
+	}
+}
+
+func (d *Decoder) decodeFrame(ctx context.Context) (DtxMessage, error) {
+	frame, err := d.readFrame(ctx)
+	if err != nil {
+		return DtxMessage{}, err
+	}
+	//every frame read counts, also ones that fail to decode, so Sequence stays the position in the stream
+	sequence := d.sequence
+	d.sequence++
+	msg, remainingBytes, err := DecodeWithOptions(frame, d.options)
+	if err != nil {
+		return DtxMessage{}, err
+	}
+	if len(remainingBytes) != 0 {
+		return DtxMessage{}, fmt.Errorf("Transport returned a frame with %d trailing bytes", len(remainingBytes))
+	}
+	msg.Sequence = sequence
+	return msg, nil
+}
+
+//readFrame reads synchronously if ctx can never be cancelled, otherwise the read runs in a goroutine
+//whose result is kept in pending until a later call picks it up.
+func (d *Decoder) readFrame(ctx context.Context) ([]byte, error) {
+	if d.pending == nil {
+		if ctx.Done() == nil {
+			return d.transport.ReadFrame()
+		}
+		pending := make(chan frameResult, 1)
+		go func() {
+			frame, err := d.transport.ReadFrame()
+			pending <- frameResult{frame: frame, err: err}
+		}()
+		d.pending = pending
+	}
+	select {
+	case result := <-d.pending:
+		d.pending = nil
+		return result.frame, result.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+//frameReader is the part of a Transport a Decoder needs
+type frameReader interface {
+	ReadFrame() ([]byte, error)
+}
+
+//streamReader cuts a byte stream into frames using the MessageLength of every header
+type streamReader struct {
+	reader  *bufio.Reader
+	buf     []byte
+	reuse   bool
+	options DecodeOptions
+}
+
+func (s *streamReader) ReadFrame() ([]byte, error) {
+	var header [32]byte
+	if _, err := io.ReadFull(s.reader, header[:]); err != nil {
+		return nil, err
+	}
+	msg, err := parseHeaderArray(&header, s.options)
+	if err != nil {
+		return nil, err
+	}
+	frameLength := s.options.wireLength(msg)
+	var buf []byte
+	if s.reuse {
+		buf = s.buf
+	}
+	frame, err := readFrameBody(s.reader, header[:], frameLength, buf)
+	if s.reuse && cap(frame) > cap(s.buf) {
+		s.buf = frame[:0]
+	}
+	if err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+//frameChunkSize is the most readFrameBody allocates ahead of the bytes that actually arrived
+const frameChunkSize = 64 << 10
+
+//readFrameBody appends header and the remaining bytes of a frame of frameLength bytes from r to buf[:0]. The
+//MessageLength comes from an untrusted header, so the buffer only grows as the bytes arrive instead of allocating
+//all of them up front. io.ErrUnexpectedEOF is returned if r ends within the frame.
+func readFrameBody(r io.Reader, header []byte, frameLength int, buf []byte) ([]byte, error) {
+	frame := append(buf[:0], header...)
+	for len(frame) < frameLength {
+		chunk := frameLength - len(frame)
+		if chunk > frameChunkSize {
+			chunk = frameChunkSize
+		}
+		if cap(frame)-len(frame) < chunk {
+			grown := make([]byte, len(frame), len(frame)+chunk+len(frame))
+			if cap(grown) > frameLength {
+				grown = grown[:len(frame):frameLength]
+			}
+			copy(grown, frame)
+			frame = grown
+		}
+		n, err := io.ReadFull(r, frame[len(frame):len(frame)+chunk])
+		frame = frame[:len(frame)+n]
+		if err != nil {
+			return frame, unexpectedEOF(err)
+		}
+	}
+	return frame, nil
+}
@@ -0,0 +1,371 @@
+package dtx_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"runtime"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/danielpaulus/dtx_codec/dtx"
+	"github.com/stretchr/testify/assert"
+)
+
+type loopbackTransport struct {
+	frames [][]byte
+}
+
+func (l *loopbackTransport) ReadFrame() ([]byte, error) {
+	if len(l.frames) == 0 {
+		return nil, io.EOF
+	}
+	frame := l.frames[0]
+	l.frames = l.frames[1:]
+	return frame, nil
+}
+
+func (l *loopbackTransport) WriteFrame(frame []byte) error {
+	l.frames = append(l.frames, frame)
+	return nil
+}
+
+func TestDecoderFromTransport(t *testing.T) {
+	transport := &loopbackTransport{}
+	for _, fixture := range []string{"fixtures/notifyOfPublishedCapabilites", "fixtures/requestChannelWithCode"} {
+		dat, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			log.Fatal(err)
+		}
+		assert.NoError(t, transport.WriteFrame(dat))
+	}
+
+	decoder := dtx.DecoderFromTransport(transport)
+	msg, err := decoder.Decode()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2, msg.Identifier)
+	}
+	msg, err = decoder.Decode()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, msg.Identifier)
+	}
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestDecoderFilter(t *testing.T) {
+	transport := &loopbackTransport{}
+	for _, frame := range dtx.GenerateAckStream(2, 1) {
+		transport.WriteFrame(frame)
+	}
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	transport.WriteFrame(dat)
+	for _, frame := range dtx.GenerateAckStream(1, 1) {
+		transport.WriteFrame(frame)
+	}
+
+	decoder := dtx.DecoderFromTransport(transport)
+	decoder.SetFilter(func(msg dtx.DtxMessage) bool {
+		return msg.PayloadHeader.MessageType == dtx.Ack
+	})
+	msg, err := decoder.Decode()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, msg.Identifier)
+		assert.NotEqual(t, dtx.Ack, msg.PayloadHeader.MessageType)
+	}
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestDecoderSequence(t *testing.T) {
+	transport := &loopbackTransport{}
+	for _, frame := range dtx.GenerateAckStream(4, 1) {
+		transport.WriteFrame(frame)
+	}
+	decoder := dtx.DecoderFromTransport(transport)
+	decoder.SetFilter(func(msg dtx.DtxMessage) bool {
+		return msg.Identifier == 2
+	})
+	for _, expected := range []int{0, 2, 3} {
+		msg, err := decoder.Decode()
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected, msg.Sequence)
+		}
+	}
+
+	//a frame that fails to decode still takes up its position
+	frames := dtx.GenerateAckStream(3, 1)
+	frames[1] = frames[1][:20]
+	decoder = dtx.DecoderFromTransport(&loopbackTransport{frames: frames})
+	msg, err := decoder.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, msg.Sequence)
+	_, err = decoder.Decode()
+	assert.Error(t, err)
+	msg, err = decoder.Decode()
+	if assert.NoError(t, err) {
+		assert.Equal(t, 3, msg.Identifier)
+		assert.Equal(t, 2, msg.Sequence)
+	}
+}
+
+func TestNewDecoder(t *testing.T) {
+	var stream []byte
+	for _, fixture := range []string{"fixtures/notifyOfPublishedCapabilites", "fixtures/requestChannelWithCode"} {
+		dat, err := ioutil.ReadFile(fixture)
+		if err != nil {
+			log.Fatal(err)
+		}
+		stream = append(stream, dat...)
+	}
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, fragment := range fragmentFrame(dat, 2) {
+		stream = append(stream, fragment...)
+	}
+
+	decoder := dtx.NewDecoder(iotest.OneByteReader(bytes.NewReader(stream)))
+	for _, expected := range []struct {
+		identifier    int
+		fragmentIndex uint16
+	}{{2, 0}, {3, 0}, {3, 0}, {3, 1}, {3, 2}} {
+		msg, err := decoder.Decode()
+		if assert.NoError(t, err) {
+			assert.Equal(t, expected.identifier, msg.Identifier)
+			assert.Equal(t, expected.fragmentIndex, msg.FragmentIndex)
+		}
+	}
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+
+	for _, length := range []int{10, 40, len(dat) - 1} {
+		_, err = dtx.NewDecoder(bytes.NewReader(dat[:length])).Decode()
+		assert.Equal(t, io.ErrUnexpectedEOF, err, "stream truncated to %d bytes", length)
+	}
+}
+
+func TestDecodeMessage(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	keepAlive, err := dtx.Encode(dtx.NewKeepAlive(1))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fragments := fragmentFrame(dat, 3)
+	stream := append([]byte{}, fragments[0]...)
+	stream = append(stream, fragments[1]...)
+	stream = append(stream, keepAlive...)
+	stream = append(stream, fragments[2]...)
+	stream = append(stream, fragments[3]...)
+	stream = append(stream, dat...)
+
+	expected, _, err := dtx.Decode(dat)
+	if err != nil {
+		log.Fatal(err)
+	}
+	decoder := dtx.NewDecoder(bytes.NewReader(stream))
+	msg, err := decoder.DecodeMessage()
+	if assert.NoError(t, err) {
+		assert.True(t, msg.IsAck())
+		assert.Equal(t, 2, msg.Sequence)
+	}
+	for _, sequence := range []int{4, 5} {
+		msg, err = decoder.DecodeMessage()
+		if assert.NoError(t, err) {
+			assert.False(t, msg.IsFragment())
+			assert.True(t, expected.Equal(msg), "%v", dtx.Diff(expected, msg))
+			assert.Equal(t, expected.Payload, msg.Payload)
+			assert.Equal(t, sequence, msg.Sequence)
+		}
+	}
+	_, err = decoder.DecodeMessage()
+	assert.Equal(t, io.EOF, err)
+
+	//a fragment retransmitted after its message was completed is skipped
+	retransmitted := append(append(bytes.Join(fragments, nil), fragments[3]...), keepAlive...)
+	decoder = dtx.NewDecoder(bytes.NewReader(retransmitted))
+	msg, err = decoder.DecodeMessage()
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected.Identifier, msg.Identifier)
+	}
+	msg, err = decoder.DecodeMessage()
+	if assert.NoError(t, err) {
+		assert.True(t, msg.IsAck())
+	}
+
+	decoder = dtx.NewDecoder(bytes.NewReader(stream))
+	decoder.SetFilter((dtx.DtxMessage).IsAck)
+	msg, err = decoder.DecodeMessage()
+	if assert.NoError(t, err) {
+		assert.Equal(t, expected.Identifier, msg.Identifier)
+	}
+}
+
+func TestDecodeMessageOptions(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	stream := bytes.Join(fragmentFrame(dat, 3), nil)
+
+	decoder := dtx.NewDecoder(bytes.NewReader(stream))
+	decoder.SetOptions(dtx.DecodeOptions{LazyPayload: true})
+	msg, err := decoder.DecodeMessage()
+	if assert.NoError(t, err) {
+		assert.Nil(t, msg.Payload)
+		payload, err := msg.DecodePayload()
+		assert.NoError(t, err)
+		assert.Equal(t, "_requestChannelWithCode:identifier:", payload[0])
+	}
+
+	decoder = dtx.NewDecoder(bytes.NewReader(stream))
+	decoder.SetOptions(dtx.DecodeOptions{PayloadCodec: jsonCodec{}})
+	msg, err = decoder.DecodeMessage()
+	var payloadError *dtx.PayloadError
+	if assert.True(t, errors.As(err, &payloadError)) {
+		assert.Equal(t, 3, msg.Identifier)
+		assert.Equal(t, 3, msg.Sequence)
+		assert.Equal(t, 2, msg.Auxiliary.Len())
+	}
+}
+
+func TestDecoderHugeMessageLength(t *testing.T) {
+	frame := buildFrame(1, 1, nil, nil)
+	binary.LittleEndian.PutUint32(frame[12:], 0xfffffff0)
+	stream := append(frame, make([]byte, 100)...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := dtx.NewDecoder(bytes.NewReader(stream)).Decode()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	_, _, err = dtx.DecodeAt(bytes.NewReader(stream), 0)
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF), "%v", err)
+	_, err = dtx.NewDecoderBuffer(bytes.NewReader(stream), nil).Decode()
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+	runtime.ReadMemStats(&after)
+	assert.True(t, after.TotalAlloc-before.TotalAlloc < 1<<20, "%d bytes allocated", after.TotalAlloc-before.TotalAlloc)
+
+	_, err = dtx.NewDecoder(bytes.NewReader(make([]byte, 64))).Decode()
+	var decodeError *dtx.DecodeError
+	if assert.True(t, errors.As(err, &decodeError), "%v", err) {
+		assert.Equal(t, dtx.StageMagic, decodeError.Stage)
+	}
+}
+
+func TestDecodeContext(t *testing.T) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	reader, writer := io.Pipe()
+	decoder := dtx.NewDecoder(reader)
+
+	go writer.Write(dat[:40])
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = decoder.DecodeContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = decoder.DecodeContext(ctx)
+	assert.Equal(t, context.Canceled, err)
+
+	go writer.Write(dat[40:])
+	msg, err := decoder.DecodeContext(context.Background())
+	if assert.NoError(t, err) {
+		assert.Equal(t, decodeFixture("fixtures/requestChannelWithCode").String(), msg.String())
+		assert.Equal(t, 0, msg.Sequence)
+	}
+
+	go writer.Write(dat)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	msg, err = decoder.DecodeContext(ctx)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, msg.Sequence)
+	}
+	writer.Close()
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestNewDecoderBuffer(t *testing.T) {
+	first, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	second, err := ioutil.ReadFile("fixtures/notifyOfPublishedCapabilites")
+	if err != nil {
+		log.Fatal(err)
+	}
+	stream := append(append(append([]byte{}, first...), second...), first...)
+	buf := make([]byte, 0, 16)
+	decoder := dtx.NewDecoderBuffer(bytes.NewReader(stream), buf)
+	for _, fixture := range []string{"fixtures/requestChannelWithCode", "fixtures/notifyOfPublishedCapabilites", "fixtures/requestChannelWithCode"} {
+		msg, err := decoder.Decode()
+		if assert.NoError(t, err) {
+			expected := decodeFixture(fixture)
+			assert.Equal(t, expected.String(), msg.String())
+			assert.Equal(t, expected.Payload, msg.Payload)
+		}
+	}
+	_, err = decoder.Decode()
+	assert.Equal(t, io.EOF, err)
+}
+
+func BenchmarkDecode(b *testing.B) {
+	dat, err := ioutil.ReadFile("fixtures/requestChannelWithCode")
+	if err != nil {
+		log.Fatal(err)
+	}
+	stream := bytes.Repeat(dat, 100)
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			remainingBytes := stream
+			for len(remainingBytes) > 0 {
+				_, remainingBytes, _ = dtx.Decode(remainingBytes)
+			}
+		}
+	})
+	b.Run("DecodeInto", func(b *testing.B) {
+		var msg dtx.DtxMessage
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			remainingBytes := stream
+			for len(remainingBytes) > 0 {
+				remainingBytes, _ = dtx.DecodeInto(remainingBytes, &msg)
+			}
+		}
+	})
+	b.Run("NewDecoder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			decoder := dtx.NewDecoder(bytes.NewReader(stream))
+			for _, err := decoder.Decode(); err == nil; _, err = decoder.Decode() {
+			}
+		}
+	})
+	b.Run("NewDecoderBuffer", func(b *testing.B) {
+		buf := make([]byte, len(dat))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			decoder := dtx.NewDecoderBuffer(bytes.NewReader(stream), buf)
+			for _, err := decoder.Decode(); err == nil; _, err = decoder.Decode() {
+			}
+		}
+	})
+}
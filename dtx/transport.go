@@ -0,0 +1,8 @@
+package dtx
+
+//Transport moves complete DTX frames, framing is entirely up to the implementation.
+//This allows to run the same code over USB, TCP or an in memory mock.
+type Transport interface {
+	ReadFrame() ([]byte, error)
+	WriteFrame([]byte) error
+}
@@ -5,4 +5,5 @@ go 1.13
 require (
 	github.com/danielpaulus/nskeyedarchiver v0.0.0-20200518100002-1651d009ef53
 	github.com/stretchr/testify v1.5.1
+	howett.net/plist v0.0.0-20200419221736-3b63eb3a43b5
 )